@@ -6,35 +6,65 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"time"
 
 	"github.com/kebab0o/sysdash/backend/internal/collect"
 	api "github.com/kebab0o/sysdash/backend/internal/http"
+	"github.com/kebab0o/sysdash/backend/internal/query"
 	"github.com/kebab0o/sysdash/backend/internal/store"
 )
 
 func main() {
-	mem := store.NewMemory()
-	app := &api.App{Store: mem}
+	retention, err := store.RetentionFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mem, err := store.Open(dataDir(), retention)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := mem.Close(); err != nil {
+			log.Printf("close store: %v", err)
+		}
+	}()
+	collectors, err := collect.Default(30 * time.Second)
+	if err != nil {
+		log.Fatalf("collectors: %v", err)
+	}
+	app := &api.App{Store: mem, Collectors: collectors, QueryLimits: query.LimitsFromEnv()}
 	srv := api.NewServer(app.Routes())
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	go collect.Start(ctx, mem, 30*time.Second)
+	go collectors.Run(ctx, mem)
 
 	stop := make(chan struct{})
-	go mem.StartScheduler(stop)
+	go store.StartScheduler(mem, stop)
+	compactEvery := time.Minute
+	if d, err := time.ParseDuration(os.Getenv("COMPACT_INTERVAL")); err == nil && d > 0 {
+		compactEvery = d
+	}
+	store.StartCompactor(mem, compactEvery, stop)
+	syncEvery := time.Second
+	if d, err := time.ParseDuration(os.Getenv("WAL_SYNC_INTERVAL")); err == nil && d > 0 {
+		syncEvery = d
+	}
+	store.StartSyncer(mem, syncEvery, stop)
 	go func() {
-		t := time.NewTicker(24 * time.Hour)
-		defer t.Stop()
+		snap := time.NewTicker(5 * time.Minute)
+		defer snap.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				close(stop)
 				return
-			case <-t.C:
-				mem.PruneForRetention()
+			case <-snap.C:
+				if err := mem.Snapshot(); err != nil {
+					log.Printf("snapshot: %v", err)
+				}
 			}
 		}
 	}()
@@ -58,3 +88,18 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// dataDir is where the store keeps its snapshot and write-ahead log:
+// DATA_DIR when set, otherwise sysdash under the user's data directory.
+func dataDir() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "sysdash")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "sysdash")
+	}
+	return "data"
+}
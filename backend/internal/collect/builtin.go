@@ -0,0 +1,422 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// Default returns a registry with every builtin collector reading the
+// running system, configured from the environment (see envConfig) on top of
+// the given default interval, plus the exec collectors listed in
+// EXEC_COLLECTORS.
+func Default(interval time.Duration) (*Registry, error) {
+	host := Host{ProcRoot: os.Getenv("PROC_ROOT"), SysRoot: os.Getenv("SYSFS_ROOT")}
+	r := NewRegistry()
+	enabled := envFilter("COLLECTORS_INCLUDE", "COLLECTORS_EXCLUDE", "")
+	for _, c := range []Collector{
+		newCPUCollector(host),
+		newMemCollector(host),
+		newDiskCollector(
+			envFilter("DISK_FSTYPE_INCLUDE", "DISK_FSTYPE_EXCLUDE", defaultFstypeExclude()),
+			envFilter("DISK_MOUNT_INCLUDE", "DISK_MOUNT_EXCLUDE", defaultMountExclude()),
+		),
+		newDiskIOCollector(host),
+		newNetCollector(host, envFilter("NET_IFACE_INCLUDE", "NET_IFACE_EXCLUDE", defaultIfaceExclude)),
+		newPressureCollector(procRoot()),
+		newCgroupCollector(cgroupSettings()),
+		newSensorCollector(sysRoot()),
+		newSocketCollector(procRoot()),
+		newProcessCollector(procRoot(), processTopN()),
+	} {
+		r.Register(c, envConfig(c.Name(), enabled, interval))
+	}
+
+	specs, err := loadExecSpecs()
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range specs {
+		cfg, err := spec.config(enabled, interval)
+		if err != nil {
+			return nil, err
+		}
+		r.Register(newExecCollector(spec), cfg)
+	}
+	return r, nil
+}
+
+// cpuCollector records utilisation overall and per core, the split of CPU
+// time across states and the load averages. Utilisation is measured between
+// two runs, so the first run only records a baseline.
+type cpuCollector struct {
+	src Source
+
+	mu        sync.Mutex
+	prev      cpu.TimesStat
+	prevCores []cpu.TimesStat
+	havePrev  bool
+}
+
+func newCPUCollector(src Source) *cpuCollector { return &cpuCollector{src: src} }
+
+func (c *cpuCollector) Name() string { return "cpu" }
+
+func (c *cpuCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	total, err := c.src.CPUTimes(ctx, false)
+	if err != nil {
+		return err
+	}
+	if len(total) == 0 {
+		return errors.New("no cpu times")
+	}
+	cores, _ := c.src.CPUTimes(ctx, true)
+
+	c.mu.Lock()
+	prev, prevCores, had := c.prev, c.prevCores, c.havePrev
+	c.prev, c.prevCores, c.havePrev = total[0], cores, true
+	c.mu.Unlock()
+
+	var errs []error
+	if had {
+		if d, ok := timesDelta(prev, total[0]); ok {
+			errs = append(errs, s.SaveCPU(types.CPUPoint{At: now, V: d.busyPct()}))
+			p := d.split()
+			p.At = now
+			errs = append(errs, s.SaveCPUTimes(p))
+		}
+		if len(cores) > 0 && len(cores) == len(prevCores) {
+			pcts := make([]float64, len(cores))
+			for i := range cores {
+				if d, ok := timesDelta(prevCores[i], cores[i]); ok {
+					pcts[i] = d.busyPct()
+				}
+			}
+			errs = append(errs, s.SaveCPUCores(types.CPUCoresPoint{At: now, Cores: pcts}))
+		}
+	}
+	if avg, err := c.src.Load(ctx); err == nil {
+		errs = append(errs, s.SaveLoad(types.LoadPoint{At: now, Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}))
+	}
+	return errors.Join(errs...)
+}
+
+// cpuDelta is the CPU time spent in each state between two readings.
+type cpuDelta struct {
+	cpu.TimesStat
+	total float64
+}
+
+// timesDelta subtracts two readings. ok is false when no time passed, which
+// also covers counters that went backwards after a CPU came back online.
+func timesDelta(prev, cur cpu.TimesStat) (cpuDelta, bool) {
+	d := cpuDelta{TimesStat: cpu.TimesStat{
+		User:    max(cur.User-prev.User, 0),
+		Nice:    max(cur.Nice-prev.Nice, 0),
+		System:  max(cur.System-prev.System, 0),
+		Idle:    max(cur.Idle-prev.Idle, 0),
+		Iowait:  max(cur.Iowait-prev.Iowait, 0),
+		Irq:     max(cur.Irq-prev.Irq, 0),
+		Softirq: max(cur.Softirq-prev.Softirq, 0),
+		Steal:   max(cur.Steal-prev.Steal, 0),
+	}}
+	d.total = d.User + d.Nice + d.System + d.Idle + d.Iowait + d.Irq + d.Softirq + d.Steal
+	return d, d.total > 0
+}
+
+// busyPct is the share of time not spent idle or waiting for IO.
+func (d cpuDelta) busyPct() float64 {
+	return (d.total - d.Idle - d.Iowait) / d.total * 100
+}
+
+func (d cpuDelta) split() types.CPUTimesPoint {
+	pct := func(v float64) float64 { return v / d.total * 100 }
+	return types.CPUTimesPoint{
+		User:    pct(d.User),
+		Nice:    pct(d.Nice),
+		System:  pct(d.System),
+		Idle:    pct(d.Idle),
+		Iowait:  pct(d.Iowait),
+		Irq:     pct(d.Irq),
+		Softirq: pct(d.Softirq),
+		Steal:   pct(d.Steal),
+	}
+}
+
+// memCollector records memory and swap usage and the major page-fault rate.
+type memCollector struct {
+	src Source
+
+	mu     sync.Mutex
+	faults counterSet
+}
+
+func newMemCollector(src Source) *memCollector {
+	return &memCollector{src: src, faults: counterSet{limit: kernelCounterMax}}
+}
+
+func (c *memCollector) Name() string { return "memory" }
+
+func (c *memCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	vm, err := c.src.Memory(ctx)
+	if err != nil {
+		return err
+	}
+	errs := []error{s.SaveMem(types.MemPoint{At: now, V: vm.UsedPercent})}
+
+	p := types.MemDetailPoint{
+		At:        now,
+		Total:     vm.Total,
+		Available: vm.Available,
+		Used:      vm.Used,
+		Cached:    vm.Cached,
+		Buffers:   vm.Buffers,
+	}
+	if sw, err := c.src.Swap(ctx); err == nil {
+		p.SwapUsed = sw.Used
+		p.SwapTotal = sw.Total
+		p.MajorFaultsPerSec = c.majorFaultRate(now, sw.PgMajFault)
+	}
+	errs = append(errs, s.SaveMemDetail(p))
+	return errors.Join(errs...)
+}
+
+// majorFaultRate turns the cumulative major page-fault counter into faults
+// per second since the previous call; 0 on the first call.
+func (c *memCollector) majorFaultRate(now time.Time, total uint64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rates, _ := c.faults.rates(now, map[string]uint64{"majflt": total})
+	return rates["majflt"]
+}
+
+// diskCollector records the usage of every mounted filesystem admitted by
+// the fstype and mountpoint filters.
+type diskCollector struct {
+	fstypes, mounts nameFilter
+}
+
+func newDiskCollector(fstypes, mounts nameFilter) *diskCollector {
+	return &diskCollector{fstypes: fstypes, mounts: mounts}
+}
+
+func (c *diskCollector) Name() string { return "disk" }
+
+func (c *diskCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	parts, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range parts {
+		mount := normalizeMount(p.Mountpoint)
+		if mount == "" || !c.fstypes.match(p.Fstype) || !c.mounts.match(mount) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		u, err := disk.UsageWithContext(ctx, mount)
+		if err != nil || u.Total == 0 {
+			continue
+		}
+		errs = append(errs, s.SaveDisk(types.DiskPoint{
+			At:            now,
+			Mount:         mount,
+			UsedPct:       u.UsedPercent,
+			UsedGB:        bytesToGB(u.Used),
+			TotalGB:       bytesToGB(u.Total),
+			InodesUsed:    u.InodesUsed,
+			InodesFree:    u.InodesFree,
+			InodesUsedPct: u.InodesUsedPercent,
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// diskIOCollector records the total disk throughput and, per whole disk,
+// throughput, IOPS, average wait and utilisation. The byte and I/O counts
+// and the millisecond times are tracked apart because the kernel prints
+// the times as 32-bit values on every host.
+type diskIOCollector struct {
+	src Source
+
+	mu     sync.Mutex
+	counts counterSet
+	times  counterSet
+}
+
+func newDiskIOCollector(src Source) *diskIOCollector {
+	return &diskIOCollector{
+		src:    src,
+		counts: counterSet{limit: kernelCounterMax},
+		times:  counterSet{limit: math.MaxUint32},
+	}
+}
+
+func (c *diskIOCollector) Name() string { return "diskio" }
+
+func (c *diskIOCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	stats, err := c.src.DiskIO(ctx)
+	if err != nil {
+		return err
+	}
+	total, devices, ok := c.metrics(now, stats)
+	if !ok {
+		return nil
+	}
+	total.At = now
+	errs := []error{s.SaveDiskIO(total)}
+	for _, p := range devices {
+		p.At = now
+		errs = append(errs, s.SaveDiskDevice(p))
+	}
+	return errors.Join(errs...)
+}
+
+// metrics derives the rates since the previous call. ok is false on the
+// first call, which only records a baseline.
+func (c *diskIOCollector) metrics(now time.Time, stats map[string]disk.IOCountersStat) (types.DiskIOPoint, []types.DiskDevicePoint, bool) {
+	counts := make(map[string]uint64, 4*len(stats))
+	times := make(map[string]uint64, 3*len(stats))
+	for name, st := range stats {
+		counts[name+"/rbytes"] = st.ReadBytes
+		counts[name+"/wbytes"] = st.WriteBytes
+		counts[name+"/reads"] = st.ReadCount
+		counts[name+"/writes"] = st.WriteCount
+		times[name+"/rtime"] = st.ReadTime
+		times[name+"/wtime"] = st.WriteTime
+		times[name+"/iotime"] = st.IoTime
+	}
+	c.mu.Lock()
+	rates, ok := c.counts.rates(now, counts)
+	timeRates, timesOK := c.times.rates(now, times)
+	c.mu.Unlock()
+	if !ok || !timesOK {
+		return types.DiskIOPoint{}, nil, false
+	}
+	maps.Copy(rates, timeRates)
+
+	var total types.DiskIOPoint
+	var out []types.DiskDevicePoint
+	for name := range stats {
+		if _, seen := rates[name+"/rbytes"]; !seen {
+			continue
+		}
+		r := func(k string) float64 { return rates[name+"/"+k] }
+		p := types.DiskDevicePoint{
+			Device:     name,
+			ReadBytes:  r("rbytes"),
+			WriteBytes: r("wbytes"),
+			ReadIOPS:   r("reads"),
+			WriteIOPS:  r("writes"),
+			// IoTime is in milliseconds, so its rate is ms busy per second.
+			UtilPct: min(r("iotime")/1000*100, 100),
+		}
+		// Wait times are also ms per second; dividing by ops per second
+		// leaves ms per op.
+		if ops := p.ReadIOPS + p.WriteIOPS; ops > 0 {
+			p.AwaitMs = (r("rtime") + r("wtime")) / ops
+		}
+		total.ReadMBs += p.ReadBytes / (1024 * 1024)
+		total.WriteMBs += p.WriteBytes / (1024 * 1024)
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Device < out[j].Device })
+	return total, out, true
+}
+
+// netCollector records the total network throughput across every interface
+// and the per-interface rates of those admitted by its filter.
+type netCollector struct {
+	src    Source
+	ifaces nameFilter
+
+	mu       sync.Mutex
+	counters counterSet
+}
+
+func newNetCollector(src Source, ifaces nameFilter) *netCollector {
+	return &netCollector{src: src, ifaces: ifaces, counters: counterSet{limit: kernelCounterMax}}
+}
+
+func (c *netCollector) Name() string { return "net" }
+
+func (c *netCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	stats, err := c.src.NetIO(ctx)
+	if err != nil {
+		return err
+	}
+	total, ifaces, ok := c.metrics(now, stats)
+	if !ok {
+		return nil
+	}
+	total.At = now
+	errs := []error{s.SaveNet(total)}
+	for _, p := range ifaces {
+		p.At = now
+		errs = append(errs, s.SaveNetIface(p))
+	}
+	return errors.Join(errs...)
+}
+
+// metrics derives the rates since the previous call. ok is false on the
+// first call, which only records a baseline. An interface seen for the
+// first time is left out until it has a baseline of its own.
+func (c *netCollector) metrics(now time.Time, stats []net.IOCountersStat) (types.NetPoint, []types.NetIfacePoint, bool) {
+	cur := make(map[string]uint64, 8*len(stats))
+	for _, st := range stats {
+		cur[st.Name+"/rxbytes"] = st.BytesRecv
+		cur[st.Name+"/txbytes"] = st.BytesSent
+		cur[st.Name+"/rxpackets"] = st.PacketsRecv
+		cur[st.Name+"/txpackets"] = st.PacketsSent
+		cur[st.Name+"/rxerrors"] = st.Errin
+		cur[st.Name+"/txerrors"] = st.Errout
+		cur[st.Name+"/rxdrops"] = st.Dropin
+		cur[st.Name+"/txdrops"] = st.Dropout
+	}
+	c.mu.Lock()
+	rates, ok := c.counters.rates(now, cur)
+	c.mu.Unlock()
+	if !ok {
+		return types.NetPoint{}, nil, false
+	}
+
+	var total types.NetPoint
+	var out []types.NetIfacePoint
+	for _, st := range stats {
+		if _, seen := rates[st.Name+"/rxbytes"]; !seen {
+			continue
+		}
+		r := func(k string) float64 { return rates[st.Name+"/"+k] }
+		total.RxKBs += r("rxbytes") / 1024
+		total.TxKBs += r("txbytes") / 1024
+		if !c.ifaces.match(st.Name) {
+			continue
+		}
+		out = append(out, types.NetIfacePoint{
+			Iface:     st.Name,
+			RxBytes:   r("rxbytes"),
+			TxBytes:   r("txbytes"),
+			RxPackets: r("rxpackets"),
+			TxPackets: r("txpackets"),
+			RxErrors:  r("rxerrors"),
+			TxErrors:  r("txerrors"),
+			RxDrops:   r("rxdrops"),
+			TxDrops:   r("txdrops"),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Iface < out[j].Iface })
+	return total, out, true
+}
@@ -0,0 +1,202 @@
+package collect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// defaultCgroupDepth covers the root, the systemd slices and the services
+// or containers inside them.
+const defaultCgroupDepth = 2
+
+// cgroupCounters holds the cumulative counters of one cgroup plus the
+// instantaneous values read alongside them.
+type cgroupCounters struct {
+	usageUsec          uint64
+	rbytes, wbytes     uint64
+	rios, wios         uint64
+	memCurrent, memMax uint64
+	pids               uint64
+}
+
+// cgroupSettings reads CGROUP_ROOT (default /sys/fs/cgroup) and CGROUP_DEPTH,
+// how many levels below the root are walked.
+func cgroupSettings() (string, int) {
+	root := os.Getenv("CGROUP_ROOT")
+	if root == "" {
+		root = "/sys/fs/cgroup"
+	}
+	depth := defaultCgroupDepth
+	if n, err := strconv.Atoi(os.Getenv("CGROUP_DEPTH")); err == nil && n >= 0 {
+		depth = n
+	}
+	return root, depth
+}
+
+// cgroupCollector records per-cgroup usage of a cgroup v2 hierarchy down to
+// a maximum depth below its root.
+type cgroupCollector struct {
+	root  string
+	depth int
+
+	mu       sync.Mutex
+	counters counterSet
+}
+
+func newCgroupCollector(root string, depth int) *cgroupCollector {
+	return &cgroupCollector{root: root, depth: depth}
+}
+
+func (c *cgroupCollector) Name() string { return "cgroups" }
+
+func (c *cgroupCollector) Collect(_ context.Context, s Saver, now time.Time) error {
+	var errs []error
+	for _, p := range c.metrics(now) {
+		p.At = now
+		errs = append(errs, s.SaveCgroup(p))
+	}
+	return errors.Join(errs...)
+}
+
+// metrics walks the hierarchy and returns per-cgroup rates since the
+// previous call. Cgroups seen for the first time only record a baseline.
+// Hosts still on cgroup v1 yield nothing.
+func (c *cgroupCollector) metrics(now time.Time) []types.CgroupPoint {
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err != nil {
+		return nil
+	}
+	groups := map[string]cgroupCounters{}
+	_ = filepath.WalkDir(c.root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(c.root, dir)
+		name := cgroupName(rel)
+		if cgroupPathDepth(name) > c.depth {
+			return filepath.SkipDir
+		}
+		groups[name] = readCgroup(dir)
+		return nil
+	})
+
+	cur := make(map[string]uint64, 5*len(groups))
+	for name, g := range groups {
+		cur[name+"/usage"] = g.usageUsec
+		cur[name+"/rbytes"] = g.rbytes
+		cur[name+"/wbytes"] = g.wbytes
+		cur[name+"/rios"] = g.rios
+		cur[name+"/wios"] = g.wios
+	}
+	c.mu.Lock()
+	rates, ok := c.counters.rates(now, cur)
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var out []types.CgroupPoint
+	for name, g := range groups {
+		usage, seen := rates[name+"/usage"]
+		if !seen {
+			continue
+		}
+		out = append(out, types.CgroupPoint{
+			Path:          name,
+			CPUPct:        usage / 1e6 * 100,
+			MemoryCurrent: g.memCurrent,
+			MemoryMax:     g.memMax,
+			IOReadBytes:   rates[name+"/rbytes"],
+			IOWriteBytes:  rates[name+"/wbytes"],
+			IOReadIOPS:    rates[name+"/rios"],
+			IOWriteIOPS:   rates[name+"/wios"],
+			Pids:          g.pids,
+		})
+	}
+	return out
+}
+
+// cgroupName turns a path relative to the root into "/" or "/a/b".
+func cgroupName(rel string) string {
+	if rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+func cgroupPathDepth(name string) int {
+	if name == "/" {
+		return 0
+	}
+	return strings.Count(name, "/")
+}
+
+// readCgroup reads the accounting files of one cgroup directory. Files a
+// cgroup lacks, such as memory.current on the root, leave their fields zero.
+func readCgroup(dir string) cgroupCounters {
+	var c cgroupCounters
+	readKeyed(filepath.Join(dir, "cpu.stat"), func(k, v string) {
+		if k == "usage_usec" {
+			c.usageUsec, _ = strconv.ParseUint(v, 10, 64)
+		}
+	})
+	c.memCurrent = readUint(filepath.Join(dir, "memory.current"))
+	c.memMax = readUint(filepath.Join(dir, "memory.max"))
+	c.pids = readUint(filepath.Join(dir, "pids.current"))
+
+	// io.stat has one line per device: "8:0 rbytes=1 wbytes=2 rios=3 wios=4 ...".
+	if b, err := os.ReadFile(filepath.Join(dir, "io.stat")); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			fields := strings.Fields(line)
+			for _, kv := range fields[min(1, len(fields)):] {
+				k, v, _ := strings.Cut(kv, "=")
+				n, _ := strconv.ParseUint(v, 10, 64)
+				switch k {
+				case "rbytes":
+					c.rbytes += n
+				case "wbytes":
+					c.wbytes += n
+				case "rios":
+					c.rios += n
+				case "wios":
+					c.wios += n
+				}
+			}
+		}
+	}
+	return c
+}
+
+// readKeyed calls fn for every "key value" line of path.
+func readKeyed(path string, fn func(k, v string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), " "); ok {
+			fn(k, strings.TrimSpace(v))
+		}
+	}
+}
+
+// readUint reads a single-value file. "max" and unreadable files read as 0.
+func readUint(path string) uint64 {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	return n
+}
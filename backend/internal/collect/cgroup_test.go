@@ -0,0 +1,118 @@
+package collect
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+func TestReadCgroup(t *testing.T) {
+	for _, tc := range []struct {
+		dir  string
+		want cgroupCounters
+	}{
+		// The root has no memory.current, memory.max or pids.current.
+		{".", cgroupCounters{usageUsec: 900000000, rbytes: 1048576, wbytes: 524288, rios: 100, wios: 50}},
+		// memory.max reads "max".
+		{"system.slice", cgroupCounters{usageUsec: 400000000, memCurrent: 2147483648, pids: 120}},
+		// io.stat sums over devices.
+		{"system.slice/nginx.service", cgroupCounters{
+			usageUsec: 5000000, rbytes: 5096, wbytes: 10192, rios: 4, wios: 6,
+			memCurrent: 52428800, memMax: 268435456, pids: 5,
+		}},
+	} {
+		t.Run(tc.dir, func(t *testing.T) {
+			if got := readCgroup(filepath.Join("testdata/cgroup", tc.dir)); got != tc.want {
+				t.Errorf("readCgroup = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func cgroupPaths(points []types.CgroupPoint) []string {
+	var paths []string
+	for _, p := range points {
+		paths = append(paths, p.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestCgroupDepth(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{"/"}},
+		{1, []string{"/", "/system.slice", "/user.slice"}},
+		{2, []string{"/", "/system.slice", "/system.slice/nginx.service", "/user.slice"}},
+		{3, []string{"/", "/system.slice", "/system.slice/nginx.service", "/system.slice/nginx.service/workers", "/user.slice"}},
+	} {
+		c := newCgroupCollector("testdata/cgroup", tc.depth)
+		if got := c.metrics(t0); got != nil {
+			t.Fatalf("depth %d: first run returned %+v, want a baseline only", tc.depth, got)
+		}
+		got := cgroupPaths(c.metrics(t0.Add(time.Second)))
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("depth %d: paths = %v, want %v", tc.depth, got, tc.want)
+		}
+	}
+
+	// Without cgroup.controllers the hierarchy is v1 and is skipped.
+	c := newCgroupCollector(filepath.Join("testdata/cgroup", "user.slice"), 2)
+	c.metrics(t0)
+	if got := c.metrics(t0.Add(time.Second)); got != nil {
+		t.Errorf("v1 hierarchy returned %+v", got)
+	}
+}
+
+func TestCgroupRates(t *testing.T) {
+	root := t.TempDir()
+	if err := os.CopyFS(root, os.DirFS("testdata/cgroup")); err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newCgroupCollector(root, 2)
+	c.metrics(t0)
+
+	// Two seconds later nginx has used one more CPU-second and read and
+	// written more on the first device.
+	dir := filepath.Join(root, "system.slice", "nginx.service")
+	write := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cpu.stat", "usage_usec 6000000\n")
+	write("io.stat", "8:0 rbytes=12288 wbytes=8192 rios=9 wios=2 dbytes=0 dios=0\n259:0 rbytes=1000 wbytes=6000 rios=3 wios=8 dbytes=0 dios=0\n")
+
+	var got *types.CgroupPoint
+	points := c.metrics(t0.Add(2 * time.Second))
+	for i := range points {
+		if points[i].Path == "/system.slice/nginx.service" {
+			got = &points[i]
+		}
+	}
+	if got == nil {
+		t.Fatalf("nginx.service missing from %v", cgroupPaths(points))
+	}
+	want := types.CgroupPoint{
+		Path:          "/system.slice/nginx.service",
+		CPUPct:        50,
+		MemoryCurrent: 52428800,
+		MemoryMax:     268435456,
+		IOReadBytes:   4096,
+		IOWriteBytes:  2000,
+		IOReadIOPS:    4,
+		IOWriteIOPS:   2,
+		Pids:          5,
+	}
+	if *got != want {
+		t.Errorf("nginx.service = %+v, want %+v", *got, want)
+	}
+}
@@ -2,14 +2,16 @@ package collect
 
 import (
 	"context"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/shirou/gopsutil/v3/common"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 
@@ -18,169 +20,142 @@ import (
 
 type Saver interface {
 	SaveCPU(types.CPUPoint) error
+	SaveCPUCores(types.CPUCoresPoint) error
+	SaveCPUTimes(types.CPUTimesPoint) error
+	SaveLoad(types.LoadPoint) error
 	SaveMem(types.MemPoint) error
+	SaveMemDetail(types.MemDetailPoint) error
 	SaveDisk(types.DiskPoint) error
 	SaveDiskIO(types.DiskIOPoint) error
+	SaveDiskDevice(types.DiskDevicePoint) error
 	SaveNet(types.NetPoint) error
+	SaveNetIface(types.NetIfacePoint) error
+	SavePressure(types.PressurePoint) error
+	SaveCgroup(types.CgroupPoint) error
+	SaveSensor(types.SensorPoint) error
+	SaveSocket(types.SocketPoint) error
+	SavePorts(types.PortSnapshot) error
+	SaveProcesses(types.ProcessSnapshot) error
+	SaveSample(types.Sample) error
 	SetLastCollector(time.Time)
+	AddLog(level, msg string)
 }
 
-var (
-	mu sync.Mutex
-
-	lastDiskReadBytes  uint64
-	lastDiskWriteBytes uint64
-	lastDiskAt         time.Time
-	haveDiskBaseline   bool
-
-	lastNetRxBytes  uint64
-	lastNetTxBytes  uint64
-	lastNetAt       time.Time
-	haveNetBaseline bool
-)
-
-func Start(ctx context.Context, s Saver, period time.Duration) {
-	mu.Lock()
-	lastDiskAt = time.Now()
-	lastNetAt = lastDiskAt
-	haveDiskBaseline = false
-	haveNetBaseline = false
-	mu.Unlock()
-
-	t := time.NewTicker(period)
-	defer t.Stop()
-
-	sample(s, period)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-t.C:
-			sample(s, period)
-		}
-	}
+// Source reads what the cpu, memory, diskio and net collectors work from.
+// Host reads the running system; anything else, such as recorded readings,
+// can stand in for it.
+type Source interface {
+	// CPUTimes returns the aggregate times, or one entry per core when
+	// perCPU is set.
+	CPUTimes(ctx context.Context, perCPU bool) ([]cpu.TimesStat, error)
+	Load(ctx context.Context) (*load.AvgStat, error)
+	Memory(ctx context.Context) (*mem.VirtualMemoryStat, error)
+	Swap(ctx context.Context) (*mem.SwapMemoryStat, error)
+	// DiskIO returns the counters of every whole disk, leaving out
+	// partitions so that summing them counts each byte once.
+	DiskIO(ctx context.Context) (map[string]disk.IOCountersStat, error)
+	NetIO(ctx context.Context) ([]net.IOCountersStat, error)
 }
 
-func sample(s Saver, period time.Duration) {
-	now := time.Now().UTC()
+// Host is the Source of the running system. ProcRoot and SysRoot replace
+// /proc and /sys when set, e.g. for a host tree mounted into a container.
+type Host struct {
+	ProcRoot string
+	SysRoot  string
+}
 
-	if vals, err := cpu.Percent(0, false); err == nil && len(vals) > 0 {
-		_ = s.SaveCPU(types.CPUPoint{At: now, V: vals[0]})
+func (h Host) context(ctx context.Context) context.Context {
+	env := common.EnvMap{}
+	if h.ProcRoot != "" {
+		env[common.HostProcEnvKey] = h.ProcRoot
 	}
-
-	if vm, err := mem.VirtualMemory(); err == nil {
-		_ = s.SaveMem(types.MemPoint{At: now, V: vm.UsedPercent})
+	if h.SysRoot != "" {
+		env[common.HostSysEnvKey] = h.SysRoot
 	}
+	return context.WithValue(ctx, common.EnvKey, env)
+}
 
-	if parts, err := disk.Partitions(false); err == nil {
-		for _, p := range parts {
-			mount := normalizeMount(p.Mountpoint)
-			if mount == "" {
-				continue
-			}
-			if u, err := disk.Usage(mount); err == nil && u.Total > 0 {
-				_ = s.SaveDisk(types.DiskPoint{
-					At:      now,
-					Mount:   mount,
-					UsedPct: u.UsedPercent,
-					UsedGB:  bytesToGB(u.Used),
-					TotalGB: bytesToGB(u.Total),
-				})
-			}
-		}
-	}
+func (h Host) CPUTimes(ctx context.Context, perCPU bool) ([]cpu.TimesStat, error) {
+	return cpu.TimesWithContext(h.context(ctx), perCPU)
+}
 
-	rd, wd := diskIOMetrics(period)
-	_ = s.SaveDiskIO(types.DiskIOPoint{At: now, ReadMBs: rd, WriteMBs: wd})
+func (h Host) Load(ctx context.Context) (*load.AvgStat, error) {
+	return load.AvgWithContext(h.context(ctx))
+}
 
-	rx, tx := netIOMetrics(period)
-	_ = s.SaveNet(types.NetPoint{At: now, RxKBs: rx, TxKBs: tx})
+func (h Host) Memory(ctx context.Context) (*mem.VirtualMemoryStat, error) {
+	return mem.VirtualMemoryWithContext(h.context(ctx))
+}
 
-	s.SetLastCollector(now)
+func (h Host) Swap(ctx context.Context) (*mem.SwapMemoryStat, error) {
+	return mem.SwapMemoryWithContext(h.context(ctx))
 }
 
-func diskIOMetrics(period time.Duration) (readMBs float64, writeMBs float64) {
-	stats, err := disk.IOCounters()
-	if err != nil || len(stats) == 0 {
-		return 0, 0
+func (h Host) DiskIO(ctx context.Context) (map[string]disk.IOCountersStat, error) {
+	stats, err := disk.IOCountersWithContext(h.context(ctx))
+	if err != nil {
+		return nil, err
 	}
-	var totalRead, totalWrite uint64
-	for _, v := range stats {
-		totalRead += v.ReadBytes
-		totalWrite += v.WriteBytes
-	}
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	now := time.Now()
-	sec := now.Sub(lastDiskAt).Seconds()
-	if sec <= 0 {
-		sec = period.Seconds()
+	sys := h.SysRoot
+	if sys == "" {
+		sys = "/sys"
 	}
-
-	if !haveDiskBaseline {
-		lastDiskReadBytes = totalRead
-		lastDiskWriteBytes = totalWrite
-		lastDiskAt = now
-		haveDiskBaseline = true
-		return 0, 0
+	for name := range stats {
+		if isPartition(sys, name) {
+			delete(stats, name)
+		}
 	}
+	return stats, nil
+}
 
-	rd := float64(totalRead-lastDiskReadBytes) / (1024.0 * 1024.0) / sec
-	wd := float64(totalWrite-lastDiskWriteBytes) / (1024.0 * 1024.0) / sec
-	if rd < 0 {
-		rd = 0
-	}
-	if wd < 0 {
-		wd = 0
-	}
+func (h Host) NetIO(ctx context.Context) ([]net.IOCountersStat, error) {
+	return net.IOCountersWithContext(h.context(ctx), true)
+}
 
-	lastDiskReadBytes = totalRead
-	lastDiskWriteBytes = totalWrite
-	lastDiskAt = now
-	return rd, wd
+// isPartition reports whether the kernel exposes name as a partition. It is
+// always false where <sys>/class/block does not exist.
+func isPartition(sys, name string) bool {
+	_, err := os.Stat(filepath.Join(sys, "class", "block", name, "partition"))
+	return err == nil
 }
 
-func netIOMetrics(period time.Duration) (rxKBs float64, txKBs float64) {
-	stats, err := net.IOCounters(false)
-	if err != nil || len(stats) == 0 {
-		return 0, 0
+// procRoot is PROC_ROOT or /proc.
+func procRoot() string {
+	if root := os.Getenv("PROC_ROOT"); root != "" {
+		return root
 	}
-	rx := stats[0].BytesRecv
-	tx := stats[0].BytesSent
-
-	mu.Lock()
-	defer mu.Unlock()
+	return "/proc"
+}
 
-	now := time.Now()
-	sec := now.Sub(lastNetAt).Seconds()
-	if sec <= 0 {
-		sec = period.Seconds()
+// sysRoot is SYSFS_ROOT or /sys.
+func sysRoot() string {
+	if root := os.Getenv("SYSFS_ROOT"); root != "" {
+		return root
 	}
+	return "/sys"
+}
 
-	if !haveNetBaseline {
-		lastNetRxBytes = rx
-		lastNetTxBytes = tx
-		lastNetAt = now
-		haveNetBaseline = true
-		return 0, 0
-	}
+// defaultIfaceExclude keeps loopback and per-container veth pairs out of the
+// per-interface series unless NET_IFACE_EXCLUDE says otherwise.
+const defaultIfaceExclude = "lo,veth*"
 
-	rxRate := float64(rx-lastNetRxBytes) / 1024.0 / sec
-	txRate := float64(tx-lastNetTxBytes) / 1024.0 / sec
-	if rxRate < 0 {
-		rxRate = 0
-	}
-	if txRate < 0 {
-		txRate = 0
+// defaultFstypeExclude lists pseudo and image filesystems that only clutter
+// the disk page. DISK_FSTYPE_EXCLUDE replaces it.
+func defaultFstypeExclude() string {
+	if runtime.GOOS != "linux" {
+		return ""
 	}
+	return "tmpfs,devtmpfs,overlay,squashfs,proc,sysfs,devpts,cgroup,cgroup2,mqueue,debugfs,tracefs," +
+		"securityfs,pstore,bpf,autofs,configfs,fusectl,hugetlbfs,nsfs,ramfs,efivarfs,binfmt_misc,rpc_pipefs"
+}
 
-	lastNetRxBytes = rx
-	lastNetTxBytes = tx
-	lastNetAt = now
-	return rxRate, txRate
+// defaultMountExclude lists mountpoints owned by the kernel, snaps and
+// container runtimes. DISK_MOUNT_EXCLUDE replaces it.
+func defaultMountExclude() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	return "/proc/**,/sys/**,/dev/**,/run/**,/snap/**,/var/lib/docker/**,/var/lib/containers/**,/var/lib/kubelet/**"
 }
 
 func bytesToGB(b uint64) float64 { return float64(b) / 1024.0 / 1024.0 / 1024.0 }
@@ -0,0 +1,70 @@
+package collect
+
+import (
+	"math"
+	"time"
+)
+
+// kernelCounterMax is the largest value of the kernel's unsigned long
+// counters in /proc/net/dev and /proc/vmstat and of the I/O and sector
+// counts in /proc/diskstats: they are as wide as the machine word, so they
+// wrap on 32-bit hosts. The time columns of /proc/diskstats are printed as
+// unsigned int and wrap at math.MaxUint32 everywhere.
+const kernelCounterMax = math.MaxUint
+
+// counterDelta returns how far a cumulative counter whose largest value is
+// limit advanced from prev to cur. A counter that went backwards has either
+// wrapped or restarted from zero, e.g. because its interface was
+// re-created. Only counters narrower than 64 bits wrap in practice, so a
+// wrap is assumed only for those and only when the wrapped distance is
+// under half the range. Anything else is a reset, in which case everything
+// counted since the restart is cur.
+func counterDelta(prev, cur, limit uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	if limit < math.MaxUint64 && prev <= limit {
+		if d := limit - prev + cur + 1; d <= limit/2 {
+			return d
+		}
+	}
+	return cur
+}
+
+// counterSet turns successive readings of named cumulative counters into
+// per-second rates. limit is the largest value the counters take; zero
+// means they are 64 bits wide.
+type counterSet struct {
+	limit uint64
+	prev  map[string]uint64
+	at    time.Time
+}
+
+// rates records cur as the reading taken at now and returns the rate of
+// every counter that also has a previous reading. Counters missing from cur
+// are forgotten. ok is false when there is no previous reading at all or the
+// clock did not move forward; in the latter case the old baseline is kept.
+func (c *counterSet) rates(now time.Time, cur map[string]uint64) (rates map[string]float64, ok bool) {
+	if c.prev != nil && !now.After(c.at) {
+		return nil, false
+	}
+	prev, sec := c.prev, now.Sub(c.at).Seconds()
+	c.prev, c.at = cur, now
+	if prev == nil {
+		return nil, false
+	}
+	rates = make(map[string]float64, len(cur))
+	for k, v := range cur {
+		if p, ok := prev[k]; ok {
+			rates[k] = float64(counterDelta(p, v, c.width())) / sec
+		}
+	}
+	return rates, true
+}
+
+func (c *counterSet) width() uint64 {
+	if c.limit == 0 {
+		return math.MaxUint64
+	}
+	return c.limit
+}
@@ -0,0 +1,119 @@
+package collect
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+)
+
+func TestCounterDelta(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		prev, cur, want uint64
+		limit           uint64
+	}{
+		{"advance", 100, 250, 150, math.MaxUint64},
+		{"unchanged", 100, 100, 0, math.MaxUint64},
+		{"32-bit wrap", math.MaxUint32 - 9, 5, 15, math.MaxUint32},
+		{"32-bit reset", 1_000_000_000, 10, 10, math.MaxUint32},
+		{"64-bit reset below 2^32", 1000, 10, 10, math.MaxUint64},
+		{"64-bit reset near 2^32", math.MaxUint32 - 9, 5, 5, math.MaxUint64},
+		{"64-bit reset", 1 << 40, 7, 7, math.MaxUint64},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := counterDelta(tc.prev, tc.cur, tc.limit); got != tc.want {
+				t.Errorf("counterDelta(%d, %d, %d) = %d, want %d", tc.prev, tc.cur, tc.limit, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCounterSetRates(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var c counterSet
+	if _, ok := c.rates(t0, map[string]uint64{"a": 100, "b": 5}); ok {
+		t.Fatal("first reading returned rates")
+	}
+	rates, ok := c.rates(t0.Add(10*time.Second), map[string]uint64{"a": 300, "b": 2, "c": 1})
+	if !ok {
+		t.Fatal("second reading returned no rates")
+	}
+	// b restarted and counted 2 since; c has no baseline yet.
+	if rates["a"] != 20 || rates["b"] != 0.2 || len(rates) != 2 {
+		t.Errorf("rates = %v, want a=20 b=0.2", rates)
+	}
+	if _, ok := c.rates(t0.Add(10*time.Second), map[string]uint64{"a": 400}); ok {
+		t.Error("a reading at the same time returned rates")
+	}
+}
+
+func TestNetCollectorUsesRunTime(t *testing.T) {
+	c := newNetCollector(nil, nameFilter{})
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, _, ok := c.metrics(t0, []net.IOCountersStat{{Name: "eth0", BytesRecv: 4096, BytesSent: 1024}}); ok {
+		t.Fatal("baseline returned rates")
+	}
+	total, _, ok := c.metrics(t0.Add(2*time.Second), []net.IOCountersStat{{Name: "eth0", BytesRecv: 8192, BytesSent: 512}})
+	if !ok {
+		t.Fatal("no rates after the baseline")
+	}
+	// Received 4 KiB in 2s; the sent counter was reset to 512.
+	if total.RxKBs != 2 || total.TxKBs != 0.25 {
+		t.Errorf("total = %+v, want 2 KiB/s in and 0.25 KiB/s out", total)
+	}
+}
+
+func TestDiskIOTimeWrap(t *testing.T) {
+	c := newDiskIOCollector(nil)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	st := disk.IOCountersStat{ReadCount: 1000, ReadTime: math.MaxUint32 - 99, IoTime: math.MaxUint32 - 499}
+	if _, _, ok := c.metrics(t0, map[string]disk.IOCountersStat{"sda": st}); ok {
+		t.Fatal("baseline returned rates")
+	}
+	// 100 reads taking 400ms in one second, during which the 32-bit read
+	// and busy times wrapped.
+	st.ReadCount += 100
+	st.ReadTime, st.IoTime = 300, 500
+	_, devices, ok := c.metrics(t0.Add(time.Second), map[string]disk.IOCountersStat{"sda": st})
+	if !ok || len(devices) != 1 {
+		t.Fatalf("got %+v, %v; want one device", devices, ok)
+	}
+	if d := devices[0]; d.ReadIOPS != 100 || d.AwaitMs != 4 || d.UtilPct != 100 {
+		t.Errorf("sda = %+v, want 100 reads/s, 4ms await, 100%% util", d)
+	}
+	st.ReadCount += 100
+	st.ReadTime, st.IoTime = 500, 750
+	_, devices, _ = c.metrics(t0.Add(2*time.Second), map[string]disk.IOCountersStat{"sda": st})
+	if d := devices[0]; d.AwaitMs != 2 || d.UtilPct != 25 {
+		t.Errorf("after the wrap sda = %+v, want 2ms await, 25%% util", d)
+	}
+}
+
+func TestRegistryClock(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var got time.Time
+	r := NewRegistry()
+	r.Clock = func() time.Time { return at }
+	r.Register(Func("probe", func(_ context.Context, _ Saver, now time.Time) error {
+		got = now
+		return nil
+	}), Config{Enabled: true, Interval: time.Minute})
+
+	m := store.NewMemory()
+	r.runOnce(context.Background(), r.entries[0], m)
+	if !got.Equal(at) {
+		t.Errorf("collector saw %v, want %v", got, at)
+	}
+	if st := r.Stats()[0]; !st.LastRun.Equal(at) {
+		t.Errorf("LastRun = %v, want %v", st.LastRun, at)
+	}
+	if !m.LastCollector().Equal(at) {
+		t.Errorf("LastCollector = %v, want %v", m.LastCollector(), at)
+	}
+}
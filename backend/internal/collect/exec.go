@@ -0,0 +1,205 @@
+package collect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// ReservedPrefix starts the names of the metrics /metrics exports itself.
+// Exec collectors may not report series under it.
+const ReservedPrefix = "sysdash_"
+
+// maxExecOutput caps how much of a command's stdout is read. A command that
+// prints more fails rather than filling the store.
+const maxExecOutput = 1 << 20
+
+// ExecSpec is one entry of the EXEC_COLLECTORS file:
+//
+//	[{"name": "queue", "command": ["/usr/local/bin/queue-depth"],
+//	  "interval": "1m", "timeout": "10s", "format": "prometheus",
+//	  "labels": {"env": "prod"}}]
+//
+// Interval falls back to the default collector interval and Timeout to
+// Interval. Format is "prometheus", "json" or empty to detect it from the
+// output.
+type ExecSpec struct {
+	Name     string       `json:"name"`
+	Command  []string     `json:"command"`
+	Interval string       `json:"interval"`
+	Timeout  string       `json:"timeout"`
+	Format   string       `json:"format"`
+	Labels   types.Labels `json:"labels"`
+}
+
+// loadExecSpecs reads the file named by EXEC_COLLECTORS. No file means no
+// exec collectors.
+func loadExecSpecs() ([]ExecSpec, error) {
+	path := os.Getenv("EXEC_COLLECTORS")
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []ExecSpec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for _, s := range specs {
+		switch {
+		case s.Name == "":
+			return nil, fmt.Errorf("%s: exec collector without a name", path)
+		case seen[s.Name]:
+			return nil, fmt.Errorf("%s: duplicate exec collector %q", path, s.Name)
+		case len(s.Command) == 0:
+			return nil, fmt.Errorf("%s: exec collector %q has no command", path, s.Name)
+		case s.Format != "" && s.Format != "prometheus" && s.Format != "json":
+			return nil, fmt.Errorf("%s: exec collector %q: unknown format %q", path, s.Name, s.Format)
+		}
+		for k := range s.Labels {
+			if !labelNameRE.MatchString(k) {
+				return nil, fmt.Errorf("%s: exec collector %q: invalid label name %q", path, s.Name, k)
+			}
+			if k == "job" {
+				return nil, fmt.Errorf("%s: exec collector %q: the job label is set to the collector name", path, s.Name)
+			}
+			if strings.HasPrefix(k, reservedLabelPrefix) {
+				return nil, fmt.Errorf("%s: exec collector %q: label names starting with %s are reserved", path, s.Name, reservedLabelPrefix)
+			}
+		}
+		seen[s.Name] = true
+	}
+	return specs, nil
+}
+
+// config turns the spec into a registry Config. Exec collectors are named
+// "exec:<name>", which COLLECTORS_INCLUDE and COLLECTORS_EXCLUDE match like
+// any other name.
+func (s ExecSpec) config(enabled nameFilter, interval time.Duration) (Config, error) {
+	cfg := Config{Enabled: enabled.match("exec:" + s.Name), Interval: interval}
+	if s.Interval != "" {
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("exec collector %q: bad interval %q", s.Name, s.Interval)
+		}
+		cfg.Interval = d
+	}
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("exec collector %q: bad timeout %q", s.Name, s.Timeout)
+		}
+		cfg.Timeout = d
+	}
+	return cfg, nil
+}
+
+// reservedLabelPrefix starts internal label names such as types.NameLabel,
+// which a sample must not set.
+const reservedLabelPrefix = "__"
+
+// reservedLabel returns a label of l whose name is reserved, if any.
+func reservedLabel(l types.Labels) (string, bool) {
+	for k := range l {
+		if strings.HasPrefix(k, reservedLabelPrefix) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// execCollector runs a command and stores every sample it prints as a
+// labeled series. Each sample gets the spec's labels, unless the command set
+// them itself, and a job label naming the collector. Samples setting job are
+// rejected: the store tells builtin series apart by their lack of one. So
+// are samples setting a reserved label, which could override the series
+// name in the store's index.
+type execCollector struct {
+	spec ExecSpec
+}
+
+func newExecCollector(spec ExecSpec) *execCollector { return &execCollector{spec: spec} }
+
+func (c *execCollector) Name() string { return "exec:" + c.spec.Name }
+
+func (c *execCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	out, err := c.run(ctx)
+	if err != nil {
+		return err
+	}
+	samples, err := parseSamples(out, c.spec.Format)
+	if err != nil {
+		return fmt.Errorf("parse output: %w", err)
+	}
+	var errs []error
+	for _, smp := range samples {
+		if _, ok := smp.Labels["job"]; ok {
+			errs = append(errs, fmt.Errorf("%s: the job label is reserved", smp.Name))
+			continue
+		}
+		if k, ok := reservedLabel(smp.Labels); ok {
+			errs = append(errs, fmt.Errorf("%s: label %s: names starting with %s are reserved", smp.Name, k, reservedLabelPrefix))
+			continue
+		}
+		if strings.HasPrefix(smp.Name, ReservedPrefix) {
+			errs = append(errs, fmt.Errorf("%s: names starting with %s are reserved", smp.Name, ReservedPrefix))
+			continue
+		}
+		labels := maps.Clone(c.spec.Labels)
+		if labels == nil {
+			labels = types.Labels{}
+		}
+		maps.Copy(labels, smp.Labels)
+		labels["job"] = c.spec.Name
+		smp.At, smp.Labels = now, labels
+		errs = append(errs, s.SaveSample(smp))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *execCollector) run(ctx context.Context) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.spec.Command[0], c.spec.Command[1:]...)
+	// Children that inherit stdout would otherwise keep Wait blocked after
+	// the command itself was killed.
+	cmd.WaitDelay = time.Second
+	stdout, stderr := &cappedBuffer{max: maxExecOutput}, &cappedBuffer{max: 4096}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	if stdout.overflow {
+		return nil, fmt.Errorf("output exceeds %d bytes", maxExecOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.overflow = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,61 @@
+package collect
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// nameFilter matches names such as interfaces or mountpoints against glob
+// patterns. A pattern ending in "/**" also matches everything below that
+// path. An empty include list admits every name that is not excluded.
+type nameFilter struct {
+	include []string
+	exclude []string
+}
+
+// envFilter builds a nameFilter from the comma separated pattern lists in
+// the include and exclude environment variables. defExclude applies when
+// the exclude variable is unset; setting it to "" disables the defaults.
+func envFilter(includeKey, excludeKey, defExclude string) nameFilter {
+	exclude, ok := os.LookupEnv(excludeKey)
+	if !ok {
+		exclude = defExclude
+	}
+	return nameFilter{include: splitList(os.Getenv(includeKey)), exclude: splitList(exclude)}
+}
+
+func (f nameFilter) match(name string) bool {
+	for _, p := range f.exclude {
+		if matchPattern(p, name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if matchPattern(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return name == prefix || strings.HasPrefix(name, prefix+"/")
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
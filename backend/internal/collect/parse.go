@@ -0,0 +1,206 @@
+package collect
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// parseSamples reads the output of an exec collector. format is
+// "prometheus", "json", or empty to guess from the first character: JSON
+// output starts with '{' or '['. Timestamps in the output are ignored, and
+// NaN and infinite values are dropped because they cannot be charted.
+func parseSamples(out []byte, format string) ([]types.Sample, error) {
+	if format == "" {
+		format = "prometheus"
+		if t := bytes.TrimSpace(out); len(t) > 0 && (t[0] == '{' || t[0] == '[') {
+			format = "json"
+		}
+	}
+	var samples []types.Sample
+	var err error
+	switch format {
+	case "prometheus":
+		samples, err = parsePrometheus(out)
+	case "json":
+		samples, err = parseJSONSamples(out)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	kept := samples[:0]
+	for _, s := range samples {
+		if err := validateSample(s); err != nil {
+			return nil, err
+		}
+		if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+			kept = append(kept, s)
+		}
+	}
+	return kept, nil
+}
+
+func validateSample(s types.Sample) error {
+	if !metricNameRE.MatchString(s.Name) {
+		return fmt.Errorf("invalid metric name %q", s.Name)
+	}
+	for k := range s.Labels {
+		if !labelNameRE.MatchString(k) {
+			return fmt.Errorf("invalid label name %q on %s", k, s.Name)
+		}
+	}
+	return nil
+}
+
+// parsePrometheus reads the Prometheus text exposition format:
+//
+//	# HELP queue_depth Jobs waiting.
+//	queue_depth{queue="mail"} 12
+func parsePrometheus(out []byte) ([]types.Sample, error) {
+	var samples []types.Sample
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		s, err := parsePrometheusLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, sc.Err()
+}
+
+func parsePrometheusLine(line string) (types.Sample, error) {
+	var s types.Sample
+	i := strings.IndexAny(line, "{ \t")
+	if i < 0 {
+		return s, errors.New("missing value")
+	}
+	s.Name, line = line[:i], line[i:]
+	if line[0] == '{' {
+		labels, rest, err := parseLabelSet(line[1:])
+		if err != nil {
+			return s, err
+		}
+		s.Labels, line = labels, rest
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, fmt.Errorf("want a value and an optional timestamp after %s", s.Name)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("bad value %q", fields[0])
+	}
+	s.Value = v
+	return s, nil
+}
+
+// parseLabelSet parses `a="x",b="y"}` and returns what follows the brace.
+func parseLabelSet(in string) (types.Labels, string, error) {
+	labels := types.Labels{}
+	for {
+		in = strings.TrimLeft(in, " \t")
+		if strings.HasPrefix(in, "}") {
+			return labels, in[1:], nil
+		}
+		eq := strings.IndexByte(in, '=')
+		if eq < 0 {
+			return nil, "", errors.New("unterminated label set")
+		}
+		name := strings.TrimSpace(in[:eq])
+		in = strings.TrimLeft(in[eq+1:], " \t")
+		if !strings.HasPrefix(in, `"`) {
+			return nil, "", fmt.Errorf("label %s: value must be quoted", name)
+		}
+		var val strings.Builder
+		j := 1
+		for ; j < len(in) && in[j] != '"'; j++ {
+			if in[j] == '\\' && j+1 < len(in) {
+				j++
+				switch in[j] {
+				case 'n':
+					val.WriteByte('\n')
+				default:
+					val.WriteByte(in[j])
+				}
+				continue
+			}
+			val.WriteByte(in[j])
+		}
+		if j >= len(in) {
+			return nil, "", fmt.Errorf("label %s: unterminated value", name)
+		}
+		labels[name] = val.String()
+		in = strings.TrimLeft(in[j+1:], " \t")
+		in = strings.TrimPrefix(in, ",")
+	}
+}
+
+// jsonSample is one sample of the JSON output format.
+type jsonSample struct {
+	Name   string       `json:"name"`
+	Labels types.Labels `json:"labels"`
+	Value  *float64     `json:"value"`
+}
+
+// parseJSONSamples reads a JSON array of {name, labels, value} objects or a
+// stream of such objects.
+func parseJSONSamples(out []byte) ([]types.Sample, error) {
+	var samples []types.Sample
+	add := func(j jsonSample) error {
+		if j.Value == nil {
+			return fmt.Errorf("sample %q has no value", j.Name)
+		}
+		samples = append(samples, types.Sample{Name: j.Name, Labels: j.Labels, Value: *j.Value})
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return samples, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if t := bytes.TrimSpace(raw); len(t) > 0 && t[0] == '[' {
+			var list []jsonSample
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, err
+			}
+			for _, j := range list {
+				if err := add(j); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		var j jsonSample
+		if err := json.Unmarshal(raw, &j); err != nil {
+			return nil, err
+		}
+		if err := add(j); err != nil {
+			return nil, err
+		}
+	}
+}
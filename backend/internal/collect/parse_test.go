@@ -0,0 +1,147 @@
+package collect
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+func TestParsePrometheus(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want []types.Sample
+	}{
+		{"plain", "up 1\n", []types.Sample{{Name: "up", Value: 1}}},
+		{
+			"comments and type lines",
+			"# HELP queue_depth Jobs waiting.\n# TYPE queue_depth gauge\n\nqueue_depth 12\n",
+			[]types.Sample{{Name: "queue_depth", Value: 12}},
+		},
+		{
+			"label set",
+			`queue_depth{queue="mail", host = "a"} 3`,
+			[]types.Sample{{Name: "queue_depth", Labels: types.Labels{"queue": "mail", "host": "a"}, Value: 3}},
+		},
+		{
+			"empty label set and trailing comma",
+			"a{} 1\nb{x=\"1\",} 2",
+			[]types.Sample{
+				{Name: "a", Labels: types.Labels{}, Value: 1},
+				{Name: "b", Labels: types.Labels{"x": "1"}, Value: 2},
+			},
+		},
+		{
+			"escapes",
+			`msg{text="say \"hi\"\\n\nnext"} 1`,
+			[]types.Sample{{Name: "msg", Labels: types.Labels{"text": "say \"hi\"\\n\nnext"}, Value: 1}},
+		},
+		{"brace in value", `a{path="/x}y"} 1`, []types.Sample{{Name: "a", Labels: types.Labels{"path": "/x}y"}, Value: 1}}},
+		{"timestamp ignored", "a 1.5 1700000000000", []types.Sample{{Name: "a", Value: 1.5}}},
+		{"exponent", "a -2e3", []types.Sample{{Name: "a", Value: -2000}}},
+		{"NaN and Inf dropped", "a NaN\nb +Inf\nc -Inf\nd 4", []types.Sample{{Name: "d", Value: 4}}},
+		{"colon in name", "job:rate5m 2", []types.Sample{{Name: "job:rate5m", Value: 2}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSamples([]byte(tc.in), "prometheus")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParsePrometheusErrors(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"up", "line 1: missing value"},
+		{`up{a="1"}`, "line 1: want a value"},
+		{"# ok\nup one", "line 2: bad value \"one\""},
+		{"up 1 2 3", "line 1: want a value and an optional timestamp"},
+		{`up{a=1} 1`, "line 1: label a: value must be quoted"},
+		{`up{a="1} 1`, "line 1: label a: unterminated value"},
+		{`up{a} 1`, "line 1: unterminated label set"},
+		{"1up 1", `invalid metric name "1up"`},
+		{`up{a-b="1"} 1`, `invalid label name "a-b" on up`},
+	} {
+		_, err := parseSamples([]byte(tc.in), "prometheus")
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parse %q: err = %v, want %q", tc.in, err, tc.want)
+		}
+	}
+}
+
+func TestParseJSONSamples(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want []types.Sample
+	}{
+		{
+			"single object",
+			`{"name": "up", "labels": {"host": "a"}, "value": 1}`,
+			[]types.Sample{{Name: "up", Labels: types.Labels{"host": "a"}, Value: 1}},
+		},
+		{
+			"array",
+			`[{"name": "a", "value": 1}, {"name": "b", "value": 0}]`,
+			[]types.Sample{{Name: "a", Value: 1}, {Name: "b", Value: 0}},
+		},
+		{
+			"stream",
+			"{\"name\": \"a\", \"value\": 1}\n{\"name\": \"b\", \"value\": 2}\n[{\"name\": \"c\", \"value\": 3}]",
+			[]types.Sample{{Name: "a", Value: 1}, {Name: "b", Value: 2}, {Name: "c", Value: 3}},
+		},
+		{"empty array", "[]", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// An empty format guesses JSON from the first character.
+			got, err := parseSamples([]byte(tc.in), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tc.want) || (len(got) > 0 && !reflect.DeepEqual(got, tc.want)) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{`{"name": "a"}`, `sample "a" has no value`},
+		{`{"name": "a", "value": "1"}`, "cannot unmarshal"},
+		{`[{"name": "a", "value": 1}`, "unexpected EOF"},
+		{`{"name": "a b", "value": 1}`, `invalid metric name "a b"`},
+	} {
+		_, err := parseSamples([]byte(tc.in), "json")
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parse %q: err = %v, want %q", tc.in, err, tc.want)
+		}
+	}
+}
+
+func TestExecCollectorReservedLabels(t *testing.T) {
+	out := "ok 1\nbad{__name__=\"other\"} 2\nworse{job=\"x\"} 3\n"
+	c := newExecCollector(ExecSpec{Name: "probe", Command: []string{"printf", "%s", out}})
+	m := store.NewMemory()
+	at := time.Now().UTC().Truncate(time.Second)
+	err := c.Collect(context.Background(), m, at)
+	if err == nil || !strings.Contains(err.Error(), "label __name__: names starting with __ are reserved") ||
+		!strings.Contains(err.Error(), "the job label is reserved") {
+		t.Errorf("Collect error = %v, want both reserved labels reported", err)
+	}
+	got := m.Select(at.Add(-time.Minute), at.Add(time.Minute))
+	if len(got) != 1 || got[0].Name != "ok" {
+		t.Errorf("stored %+v, want only ok", got)
+	}
+}
@@ -0,0 +1,101 @@
+package collect
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// pressureCollector records the pressure-stall information under a proc
+// root.
+type pressureCollector struct {
+	root string
+}
+
+func newPressureCollector(root string) *pressureCollector { return &pressureCollector{root: root} }
+
+func (c *pressureCollector) Name() string { return "pressure" }
+
+func (c *pressureCollector) Collect(_ context.Context, s Saver, now time.Time) error {
+	var errs []error
+	for _, p := range pressureMetrics(c.root, now) {
+		errs = append(errs, s.SavePressure(p))
+	}
+	return errors.Join(errs...)
+}
+
+// pressureMetrics reads <root>/pressure/{cpu,memory,io}. Resources the
+// kernel does not report, because it predates PSI or was booted with
+// psi=0, are left out, so the result is empty on such hosts.
+func pressureMetrics(root string, at time.Time) []types.PressurePoint {
+	var out []types.PressurePoint
+	for _, res := range pressureResources {
+		p, err := readPressure(filepath.Join(root, "pressure", res))
+		if err != nil {
+			continue
+		}
+		p.At = at
+		p.Resource = res
+		out = append(out, p)
+	}
+	return out
+}
+
+// readPressure parses one PSI file:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//
+// The cpu file has no full line before Linux 5.13.
+func readPressure(path string) (types.PressurePoint, error) {
+	var p types.PressurePoint
+	f, err := os.Open(path)
+	if err != nil {
+		return p, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var avg10, avg60, avg300 *float64
+		var total *uint64
+		switch fields[0] {
+		case "some":
+			avg10, avg60, avg300, total = &p.SomeAvg10, &p.SomeAvg60, &p.SomeAvg300, &p.SomeTotal
+		case "full":
+			avg10, avg60, avg300, total = &p.FullAvg10, &p.FullAvg60, &p.FullAvg300, &p.FullTotal
+		default:
+			continue
+		}
+		for _, kv := range fields[1:] {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "avg10":
+				*avg10, _ = strconv.ParseFloat(v, 64)
+			case "avg60":
+				*avg60, _ = strconv.ParseFloat(v, 64)
+			case "avg300":
+				*avg300, _ = strconv.ParseFloat(v, 64)
+			case "total":
+				*total, _ = strconv.ParseUint(v, 10, 64)
+			}
+		}
+	}
+	return p, sc.Err()
+}
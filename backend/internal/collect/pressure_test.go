@@ -0,0 +1,53 @@
+package collect
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+func TestReadPressure(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		want types.PressurePoint
+	}{
+		{"cpu", types.PressurePoint{SomeAvg10: 1.53, SomeAvg60: 0.87, SomeAvg300: 0.24, SomeTotal: 12345678}},
+		{"memory", types.PressurePoint{
+			SomeAvg60: 0.12, SomeAvg300: 0.05, SomeTotal: 98765,
+			FullAvg60: 0.03, FullAvg300: 0.01, FullTotal: 4321,
+		}},
+		{"io", types.PressurePoint{
+			SomeAvg10: 12.5, SomeAvg60: 8.25, SomeAvg300: 3.1, SomeTotal: 555000111,
+			FullAvg10: 10, FullAvg60: 6.75, FullAvg300: 2.5, FullTotal: 444000222,
+		}},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			got, err := readPressure("testdata/proc/pressure/" + tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("readPressure = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPressureMetrics(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := pressureMetrics("testdata/proc", at)
+	if len(got) != len(pressureResources) {
+		t.Fatalf("got %d points, want %d", len(got), len(pressureResources))
+	}
+	for i, p := range got {
+		if p.Resource != pressureResources[i] || !p.At.Equal(at) {
+			t.Errorf("point %d = %s at %v, want %s at %v", i, p.Resource, p.At, pressureResources[i], at)
+		}
+	}
+
+	// A kernel without PSI has no pressure directory.
+	if got := pressureMetrics(t.TempDir(), at); len(got) != 0 {
+		t.Errorf("without PSI got %+v, want none", got)
+	}
+}
@@ -0,0 +1,131 @@
+package collect
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/common"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+const defaultProcessTopN = 10
+
+// procContext points gopsutil at a proc root, e.g. a host /proc mounted
+// into a container or a fixture tree.
+func procContext(ctx context.Context, root string) context.Context {
+	return context.WithValue(ctx, common.EnvKey, common.EnvMap{common.HostProcEnvKey: root})
+}
+
+// processTopN reads PROCESS_TOP_N, falling back to defaultProcessTopN.
+func processTopN() int {
+	if n, err := strconv.Atoi(os.Getenv("PROCESS_TOP_N")); err == nil && n > 0 {
+		return n
+	}
+	return defaultProcessTopN
+}
+
+// processCollector records the top N processes by CPU and by RSS. It keeps
+// the process handles between runs so that CPU usage is measured since the
+// previous run; a process seen for the first time reports 0.
+type processCollector struct {
+	root string
+	topN int
+
+	mu    sync.Mutex
+	cache map[int32]*process.Process
+}
+
+func newProcessCollector(root string, topN int) *processCollector {
+	return &processCollector{root: root, topN: topN}
+}
+
+func (c *processCollector) Name() string { return "processes" }
+
+func (c *processCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	procs, err := c.metrics(ctx)
+	if err != nil {
+		return err
+	}
+	return s.SaveProcesses(types.ProcessSnapshot{At: now, Processes: procs})
+}
+
+type procSample struct {
+	p   *process.Process
+	cpu float64
+	rss uint64
+}
+
+func (c *processCollector) metrics(ctx context.Context) ([]types.ProcessInfo, error) {
+	ctx = procContext(ctx, c.root)
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[int32]*process.Process, len(procs))
+	samples := make([]procSample, 0, len(procs))
+	for _, fresh := range procs {
+		p, ok := c.cache[fresh.Pid]
+		if !ok {
+			p = fresh
+		}
+		seen[p.Pid] = p
+		cpu, err := p.PercentWithContext(ctx, 0)
+		if err != nil {
+			continue
+		}
+		s := procSample{p: p, cpu: cpu}
+		if mi, err := p.MemoryInfoWithContext(ctx); err == nil {
+			s.rss = mi.RSS
+		}
+		samples = append(samples, s)
+	}
+	c.cache = seen
+
+	top := make(map[int32]procSample, 2*c.topN)
+	sort.Slice(samples, func(i, j int) bool { return samples[i].cpu > samples[j].cpu })
+	for _, s := range samples[:min(c.topN, len(samples))] {
+		top[s.p.Pid] = s
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].rss > samples[j].rss })
+	for _, s := range samples[:min(c.topN, len(samples))] {
+		top[s.p.Pid] = s
+	}
+
+	out := make([]types.ProcessInfo, 0, len(top))
+	for _, s := range top {
+		out = append(out, describeProcess(ctx, s))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CPUPct > out[j].CPUPct })
+	return out, nil
+}
+
+// describeProcess fills in the fields that are too costly to read for every
+// process. Fields the caller may not read, e.g. another user's fds, stay
+// zero.
+func describeProcess(ctx context.Context, s procSample) types.ProcessInfo {
+	p := s.p
+	info := types.ProcessInfo{PID: p.Pid, CPUPct: s.cpu, RSSBytes: s.rss}
+	info.Name, _ = p.NameWithContext(ctx)
+	if args, err := p.CmdlineSliceWithContext(ctx); err == nil {
+		info.Cmdline = strings.Join(args, " ")
+	}
+	info.User, _ = p.UsernameWithContext(ctx)
+	info.Threads, _ = p.NumThreadsWithContext(ctx)
+	info.FDs, _ = p.NumFDsWithContext(ctx)
+	if io, err := p.IOCountersWithContext(ctx); err == nil {
+		info.ReadBytes = io.ReadBytes
+		info.WriteBytes = io.WriteBytes
+	}
+	return info
+}
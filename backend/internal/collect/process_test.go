@@ -0,0 +1,112 @@
+package collect
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// procFixture copies testdata/proc into a temporary root. gopsutil only
+// lists pids that exist on the host, so pid 100 becomes the test's own pid.
+func procFixture(t *testing.T) (root string, self int32) {
+	t.Helper()
+	pid := os.Getpid()
+	if pid == 1 {
+		t.Skip("test runs as pid 1")
+	}
+	root = t.TempDir()
+	if err := os.CopyFS(root, os.DirFS("testdata/proc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(root, "100"), filepath.Join(root, strconv.Itoa(pid))); err != nil {
+		t.Fatal(err)
+	}
+	return root, int32(pid)
+}
+
+func TestProcessCollectorReaders(t *testing.T) {
+	root, self := procFixture(t)
+	c := newProcessCollector(root, 2)
+	procs, err := c.metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("got %d processes, want 2: %+v", len(procs), procs)
+	}
+
+	wantUser := ""
+	if u, err := user.LookupId("0"); err == nil {
+		wantUser = u.Username
+	}
+	page := uint64(os.Getpagesize())
+	byPID := map[int32]struct {
+		name, cmdline string
+		threads, fds  int32
+		rss           uint64
+		read, written uint64
+	}{
+		1:    {"init", "/sbin/init splash", 1, 3, 2048 * page, 8192000, 4096000},
+		self: {"worker thread", "/usr/bin/worker --queue jobs", 4, 5, 512 * page, 4096, 12288},
+	}
+	for _, p := range procs {
+		want, ok := byPID[p.PID]
+		if !ok {
+			t.Fatalf("unexpected pid %d", p.PID)
+		}
+		if p.Name != want.name || p.Cmdline != want.cmdline {
+			t.Errorf("pid %d: name %q cmdline %q, want %q %q", p.PID, p.Name, p.Cmdline, want.name, want.cmdline)
+		}
+		if p.Threads != want.threads || p.FDs != want.fds {
+			t.Errorf("pid %d: threads %d fds %d, want %d %d", p.PID, p.Threads, p.FDs, want.threads, want.fds)
+		}
+		if p.RSSBytes != want.rss {
+			t.Errorf("pid %d: rss = %d, want %d", p.PID, p.RSSBytes, want.rss)
+		}
+		if p.ReadBytes != want.read || p.WriteBytes != want.written {
+			t.Errorf("pid %d: io %d/%d, want %d/%d", p.PID, p.ReadBytes, p.WriteBytes, want.read, want.written)
+		}
+		if p.User != wantUser {
+			t.Errorf("pid %d: user = %q, want %q", p.PID, p.User, wantUser)
+		}
+		if p.CPUPct != 0 {
+			t.Errorf("pid %d: first run cpu = %v, want 0", p.PID, p.CPUPct)
+		}
+	}
+}
+
+func TestProcessCollectorTopN(t *testing.T) {
+	root, self := procFixture(t)
+	c := newProcessCollector(root, 1)
+	ctx := context.Background()
+	if _, err := c.metrics(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Advance utime of the worker so it tops the CPU list while init keeps
+	// the larger RSS; both must be kept, busiest first.
+	path := filepath.Join(root, strconv.Itoa(int(self)), "stat")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := strings.Replace(string(b), " 4000 1000 ", " 9000 1000 ", 1)
+	if err := os.WriteFile(path, []byte(stat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	procs, err := c.metrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 2 || procs[0].PID != self || procs[1].PID != 1 {
+		t.Fatalf("got %+v, want pid %d then pid 1", procs, self)
+	}
+	if procs[0].CPUPct <= 0 {
+		t.Errorf("worker cpu = %v, want > 0", procs[0].CPUPct)
+	}
+}
@@ -0,0 +1,235 @@
+package collect
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Collector is one metric source. Collect reads the source once and saves
+// what it found; it should give up when ctx is done.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context, s Saver, now time.Time) error
+}
+
+// Func turns a function into a Collector.
+func Func(name string, fn func(ctx context.Context, s Saver, now time.Time) error) Collector {
+	return funcCollector{name: name, fn: fn}
+}
+
+type funcCollector struct {
+	name string
+	fn   func(ctx context.Context, s Saver, now time.Time) error
+}
+
+func (c funcCollector) Name() string { return c.name }
+func (c funcCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	return c.fn(ctx, s, now)
+}
+
+// Config controls how a Registry runs one collector. A zero Timeout means
+// the interval.
+type Config struct {
+	Enabled  bool
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Stats describes the runs of one collector so far.
+type Stats struct {
+	Name         string
+	Enabled      bool
+	Interval     time.Duration
+	Timeout      time.Duration
+	Running      bool
+	Runs         uint64
+	Errors       uint64
+	Timeouts     uint64
+	Skipped      uint64
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	LastErrorAt  time.Time
+}
+
+// Registry runs every enabled collector on its own interval. A collector
+// that overruns its timeout is abandoned for that run and its next ticks are
+// skipped until the stuck call returns, so one hung source cannot delay the
+// others.
+type Registry struct {
+	// Clock, when set, replaces the wall clock as the time of each run. It
+	// is the time handed to Collect, so every rate a collector derives from
+	// it follows the same clock. It must be set before Run.
+	Clock Clock
+
+	mu      sync.Mutex
+	entries []*entry
+}
+
+// Clock returns the current time.
+type Clock func() time.Time
+
+func (c Clock) now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c()
+}
+
+type entry struct {
+	c       Collector
+	cfg     Config
+	busy    bool
+	failing bool
+	stats   Stats
+}
+
+func NewRegistry() *Registry { return &Registry{} }
+
+// Register adds c. It must be called before Run.
+func (r *Registry) Register(c Collector, cfg Config) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, &entry{c: c, cfg: cfg})
+}
+
+// Run starts every enabled collector and blocks until ctx is done.
+func (r *Registry) Run(ctx context.Context, s Saver) {
+	r.mu.Lock()
+	entries := append([]*entry(nil), r.entries...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		if !e.cfg.Enabled || e.cfg.Interval <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			r.loop(ctx, e, s)
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (r *Registry) loop(ctx context.Context, e *entry, s Saver) {
+	t := time.NewTicker(e.cfg.Interval)
+	defer t.Stop()
+
+	r.runOnce(ctx, e, s)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.runOnce(ctx, e, s)
+		}
+	}
+}
+
+func (r *Registry) runOnce(ctx context.Context, e *entry, s Saver) {
+	r.mu.Lock()
+	if e.busy {
+		e.stats.Skipped++
+		r.mu.Unlock()
+		return
+	}
+	e.busy = true
+	r.mu.Unlock()
+
+	start, now := time.Now(), r.Clock.now().UTC()
+	cctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		err := e.c.Collect(cctx, s, now)
+		r.mu.Lock()
+		e.busy = false
+		r.mu.Unlock()
+		done <- err
+	}()
+
+	var err error
+	timedOut := false
+	select {
+	case err = <-done:
+	case <-cctx.Done():
+		if ctx.Err() != nil {
+			return
+		}
+		timedOut = true
+		err = fmt.Errorf("timed out after %s", e.cfg.Timeout)
+	}
+
+	r.mu.Lock()
+	e.stats.Runs++
+	e.stats.LastRun = now
+	e.stats.LastDuration = time.Since(start)
+	changed := err != nil && (!e.failing || e.stats.LastError != err.Error())
+	recovered := err == nil && e.failing
+	if err != nil {
+		e.stats.Errors++
+		if timedOut {
+			e.stats.Timeouts++
+		}
+		e.stats.LastError = err.Error()
+		e.stats.LastErrorAt = now
+	}
+	e.failing = err != nil
+	r.mu.Unlock()
+
+	// Only changes are logged, so a collector that keeps failing the same
+	// way does not flood the log.
+	switch {
+	case changed:
+		s.AddLog("ERROR", "collector "+e.c.Name()+" failed: "+err.Error())
+	case recovered:
+		s.AddLog("INFO", "collector "+e.c.Name()+" recovered")
+	}
+	if err == nil {
+		s.SetLastCollector(now)
+	}
+}
+
+// Stats returns the stats of every registered collector, sorted by name.
+func (r *Registry) Stats() []Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Stats, 0, len(r.entries))
+	for _, e := range r.entries {
+		st := e.stats
+		st.Name = e.c.Name()
+		st.Enabled = e.cfg.Enabled
+		st.Interval = e.cfg.Interval
+		st.Timeout = e.cfg.Timeout
+		st.Running = e.busy
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// envConfig reads the config of the named collector from the environment:
+// COLLECTORS_INCLUDE and COLLECTORS_EXCLUDE select collectors by name, and
+// COLLECTOR_<NAME>_INTERVAL and COLLECTOR_<NAME>_TIMEOUT take Go durations
+// such as "10s". Unset or invalid durations fall back to interval.
+func envConfig(name string, enabled nameFilter, interval time.Duration) Config {
+	cfg := Config{Enabled: enabled.match(name), Interval: interval}
+	prefix := "COLLECTOR_" + strings.ToUpper(name) + "_"
+	if d, err := time.ParseDuration(os.Getenv(prefix + "INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if d, err := time.ParseDuration(os.Getenv(prefix + "TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	return cfg
+}
@@ -0,0 +1,136 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// sensorCollector records hardware sensors under a sysfs root.
+type sensorCollector struct {
+	root string
+}
+
+func newSensorCollector(root string) *sensorCollector { return &sensorCollector{root: root} }
+
+func (c *sensorCollector) Name() string { return "sensors" }
+
+func (c *sensorCollector) Collect(_ context.Context, s Saver, now time.Time) error {
+	var errs []error
+	for _, p := range sensorMetrics(c.root, now) {
+		errs = append(errs, s.SaveSensor(p))
+	}
+	return errors.Join(errs...)
+}
+
+// sensorMetrics reads every temperature and fan input under
+// <root>/class/hwmon and every thermal zone under <root>/class/thermal.
+// Hosts without either directory yield nothing.
+func sensorMetrics(root string, at time.Time) []types.SensorPoint {
+	out := hwmonSensors(filepath.Join(root, "class", "hwmon"))
+	out = append(out, thermalSensors(filepath.Join(root, "class", "thermal"))...)
+	for i := range out {
+		out[i].At = at
+	}
+	return out
+}
+
+// hwmonSensors reads tempN_input (millidegrees) and fanN_input (RPM) of every
+// chip. The chip is named after its name file; a chip whose name is already
+// taken, e.g. a second nvme drive, also gets its hwmon directory.
+func hwmonSensors(dir string) []types.SensorPoint {
+	chips, _ := filepath.Glob(filepath.Join(dir, "hwmon*"))
+	sort.Strings(chips)
+	seen := map[string]bool{}
+	var out []types.SensorPoint
+	for _, chipDir := range chips {
+		chip := sanitizeChip(readString(filepath.Join(chipDir, "name")))
+		if chip == "" {
+			chip = filepath.Base(chipDir)
+		}
+		if seen[chip] {
+			chip += "-" + filepath.Base(chipDir)
+		}
+		seen[chip] = true
+
+		for _, s := range []struct {
+			kind, prefix string
+			scale        float64
+		}{
+			{"temp", "temp", 1000},
+			{"fan", "fan", 1},
+		} {
+			inputs, _ := filepath.Glob(filepath.Join(chipDir, s.prefix+"*_input"))
+			sort.Strings(inputs)
+			for _, input := range inputs {
+				v, ok := readFloat(input)
+				if !ok {
+					continue
+				}
+				base := strings.TrimSuffix(input, "_input")
+				label := readString(base + "_label")
+				if label == "" {
+					label = filepath.Base(base)
+				}
+				p := types.SensorPoint{Kind: s.kind, Chip: chip, Label: label, Value: v / s.scale}
+				if c, ok := readFloat(base + "_crit"); ok {
+					p.Crit = c / s.scale
+				}
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// thermalSensors reads each thermal zone's temp and its critical trip point.
+func thermalSensors(dir string) []types.SensorPoint {
+	zones, _ := filepath.Glob(filepath.Join(dir, "thermal_zone*"))
+	sort.Strings(zones)
+	var out []types.SensorPoint
+	for _, zone := range zones {
+		v, ok := readFloat(filepath.Join(zone, "temp"))
+		if !ok {
+			continue
+		}
+		label := readString(filepath.Join(zone, "type"))
+		if label == "" {
+			label = filepath.Base(zone)
+		}
+		p := types.SensorPoint{Kind: "temp", Chip: filepath.Base(zone), Label: label, Value: v / 1000}
+		trips, _ := filepath.Glob(filepath.Join(zone, "trip_point_*_type"))
+		for _, trip := range trips {
+			if readString(trip) != "critical" {
+				continue
+			}
+			if c, ok := readFloat(strings.TrimSuffix(trip, "_type") + "_temp"); ok {
+				p.Crit = c / 1000
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// sanitizeChip keeps chip names usable as one element of a series key.
+func sanitizeChip(s string) string { return strings.ReplaceAll(s, "/", "_") }
+
+func readString(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readFloat(path string) (float64, bool) {
+	v, err := strconv.ParseFloat(readString(path), 64)
+	return v, err == nil
+}
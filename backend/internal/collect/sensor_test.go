@@ -0,0 +1,50 @@
+package collect
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+func TestHwmonSensors(t *testing.T) {
+	want := []types.SensorPoint{
+		{Kind: "temp", Chip: "coretemp", Label: "Package id 0", Value: 52, Crit: 100},
+		{Kind: "temp", Chip: "coretemp", Label: "Core 0", Value: 48.5, Crit: 100},
+		{Kind: "temp", Chip: "nvme", Label: "Composite", Value: 38.85},
+		// A second chip of the same name is told apart by its directory,
+		// and an input without a label is named after its file.
+		{Kind: "temp", Chip: "nvme-hwmon2", Label: "temp1", Value: 41.85},
+		// Slashes in the name are replaced and the empty fan2_input is
+		// skipped.
+		{Kind: "fan", Chip: "acpi_fan", Label: "CPU fan", Value: 1200},
+	}
+	got := hwmonSensors("testdata/sys/class/hwmon")
+	if !slices.Equal(got, want) {
+		t.Errorf("hwmonSensors =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSensorMetrics(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	got := sensorMetrics("testdata/sys", at)
+	if len(got) != 6 {
+		t.Fatalf("got %d sensors, want 6: %+v", len(got), got)
+	}
+	for _, p := range got {
+		if !p.At.Equal(at) {
+			t.Errorf("%s/%s at %v, want %v", p.Chip, p.Label, p.At, at)
+		}
+	}
+	// The thermal zone takes its critical trip point, not the passive one.
+	zone := got[len(got)-1]
+	zone.At = time.Time{}
+	if want := (types.SensorPoint{Kind: "temp", Chip: "thermal_zone0", Label: "x86_pkg_temp", Value: 45, Crit: 105}); zone != want {
+		t.Errorf("thermal zone = %+v, want %+v", zone, want)
+	}
+
+	if got := sensorMetrics(t.TempDir(), at); len(got) != 0 {
+		t.Errorf("empty sysfs got %+v, want none", got)
+	}
+}
@@ -0,0 +1,112 @@
+package collect
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// tcpStates are always reported, so a state that drops to zero shows up as
+// zero instead of a gap.
+var tcpStates = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+// socketCollector counts TCP sockets by state and UDP sockets overall, and
+// lists the listening ports with their owning process where it can be
+// resolved.
+type socketCollector struct {
+	root string
+}
+
+func newSocketCollector(root string) *socketCollector { return &socketCollector{root: root} }
+
+func (c *socketCollector) Name() string { return "sockets" }
+
+func (c *socketCollector) Collect(ctx context.Context, s Saver, now time.Time) error {
+	counts, ports, err := socketMetrics(procContext(ctx, c.root))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range counts {
+		p.At = now
+		errs = append(errs, s.SaveSocket(p))
+	}
+	errs = append(errs, s.SavePorts(types.PortSnapshot{At: now, Ports: ports}))
+	return errors.Join(errs...)
+}
+
+func socketMetrics(ctx context.Context) ([]types.SocketPoint, []types.ListeningPort, error) {
+	conns, err := net.ConnectionsWithContext(ctx, "inet")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tcp := make(map[string]int, len(tcpStates))
+	udp := 0
+	names := map[int32]string{}
+	seen := map[types.ListeningPort]bool{}
+	var ports []types.ListeningPort
+	for _, c := range conns {
+		var proto string
+		switch c.Type {
+		case syscall.SOCK_STREAM:
+			proto = "tcp"
+			tcp[c.Status]++
+			if c.Status != "LISTEN" {
+				continue
+			}
+		case syscall.SOCK_DGRAM:
+			proto = "udp"
+			udp++
+			if c.Raddr.Port != 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		p := types.ListeningPort{Protocol: proto, Address: c.Laddr.IP, Port: c.Laddr.Port, PID: c.Pid}
+		if c.Pid > 0 {
+			name, ok := names[c.Pid]
+			if !ok {
+				if proc, err := process.NewProcessWithContext(ctx, c.Pid); err == nil {
+					name, _ = proc.NameWithContext(ctx)
+				}
+				names[c.Pid] = name
+			}
+			p.Process = name
+		}
+		// SO_REUSEPORT and forked workers list the same port once per socket.
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		a, b := ports[i], ports[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Address < b.Address
+	})
+
+	counts := make([]types.SocketPoint, 0, len(tcpStates)+1)
+	for _, st := range tcpStates {
+		counts = append(counts, types.SocketPoint{Protocol: "tcp", State: st, Count: tcp[st]})
+	}
+	counts = append(counts, types.SocketPoint{Protocol: "udp", State: "ALL", Count: udp})
+	return counts, ports, nil
+}
@@ -0,0 +1,190 @@
+package http
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type aggFunc func(vals []float64) float64
+
+var aggs = map[string]aggFunc{
+	"avg": func(vals []float64) float64 {
+		var sum float64
+		for _, v := range vals {
+			sum += v
+		}
+		return sum / float64(len(vals))
+	},
+	"min": func(vals []float64) float64 {
+		out := math.Inf(1)
+		for _, v := range vals {
+			out = math.Min(out, v)
+		}
+		return out
+	},
+	"max": func(vals []float64) float64 {
+		out := math.Inf(-1)
+		for _, v := range vals {
+			out = math.Max(out, v)
+		}
+		return out
+	},
+	"last": func(vals []float64) float64 { return vals[len(vals)-1] },
+	"sum": func(vals []float64) float64 {
+		var sum float64
+		for _, v := range vals {
+			sum += v
+		}
+		return sum
+	},
+	"p95": func(vals []float64) float64 { return percentile(vals, 0.95) },
+}
+
+// parseStep reads the step and agg query parameters. A zero step means the
+// points are returned as stored; agg defaults to avg.
+func parseStep(r *http.Request) (time.Duration, aggFunc, error) {
+	q := r.URL.Query()
+	var step time.Duration
+	if s := q.Get("step"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return 0, nil, errors.New("invalid step: want a positive duration such as 1m or 5m")
+		}
+		step = d
+	}
+	name := q.Get("agg")
+	if name == "" {
+		name = "avg"
+	}
+	agg, ok := aggs[name]
+	if !ok {
+		return 0, nil, errors.New("invalid agg: want one of avg, min, max, last, sum, p95")
+	}
+	return step, agg, nil
+}
+
+// pointField is one numeric field of a point type.
+type pointField[P any] struct {
+	name string
+	get  func(P) float64
+	set  func(*P, float64)
+}
+
+// pointFields tells downsample how to bucket a point type: at reaches the
+// timestamp and fields are the values aggregated per bucket.
+type pointFields[P any] struct {
+	at     func(*P) *time.Time
+	fields []pointField[P]
+}
+
+// downsample groups time-ordered points into step-wide buckets and builds one
+// point per bucket. Each point of the result is the first point of its
+// bucket, moved to the bucket start, with every field of t replaced by agg of
+// that field over the bucket; other fields, such as a disk point's mount,
+// are kept as they are.
+func downsample[P any](pts []P, step time.Duration, agg aggFunc, t pointFields[P]) []P {
+	if step <= 0 || len(pts) == 0 {
+		return pts
+	}
+	var out []P
+	vals := make([]float64, 0, len(pts))
+	res := make([]float64, len(t.fields))
+	for i := 0; i < len(pts); {
+		start := t.at(&pts[i]).Truncate(step)
+		j := i + 1
+		for j < len(pts) && t.at(&pts[j]).Truncate(step).Equal(start) {
+			j++
+		}
+		group := pts[i:j]
+		for k, f := range t.fields {
+			vals = vals[:0]
+			for _, p := range group {
+				vals = append(vals, f.get(p))
+			}
+			res[k] = agg(vals)
+		}
+		p := group[0]
+		*t.at(&p) = start
+		for k, f := range t.fields {
+			f.set(&p, res[k])
+		}
+		out = append(out, p)
+		i = j
+	}
+	return out
+}
+
+// The fields of the point types the store keeps as families come from the
+// store, so a downsampled point rounds its integers the way a rollup does.
+var (
+	cpuFields        = storeFields(func(p *types.CPUPoint) *time.Time { return &p.At })
+	cpuTimesFields   = storeFields(func(p *types.CPUTimesPoint) *time.Time { return &p.At })
+	loadFields       = storeFields(func(p *types.LoadPoint) *time.Time { return &p.At })
+	memPointFields   = storeFields(func(p *types.MemPoint) *time.Time { return &p.At })
+	diskFields       = storeFields(func(p *types.DiskPoint) *time.Time { return &p.At })
+	diskIOFields     = storeFields(func(p *types.DiskIOPoint) *time.Time { return &p.At })
+	diskDeviceFields = storeFields(func(p *types.DiskDevicePoint) *time.Time { return &p.At })
+	netFields        = storeFields(func(p *types.NetPoint) *time.Time { return &p.At })
+	netIfaceFields   = storeFields(func(p *types.NetIfacePoint) *time.Time { return &p.At })
+	pressureFields   = storeFields(func(p *types.PressurePoint) *time.Time { return &p.At })
+	sensorFields     = storeFields(func(p *types.SensorPoint) *time.Time { return &p.At })
+	socketFields     = storeFields(func(p *types.SocketPoint) *time.Time { return &p.At })
+	cgroupFields     = storeFields(func(p *types.CgroupPoint) *time.Time { return &p.At })
+)
+
+// storeFields returns the fields store.Fields lists for P, named after
+// their metrics.
+func storeFields[P any](at func(*P) *time.Time) pointFields[P] {
+	t := pointFields[P]{at: at}
+	for _, f := range store.Fields[P]() {
+		t.fields = append(t.fields, pointField[P]{name: f.Name(), get: f.Get, set: f.Set})
+	}
+	return t
+}
+
+// cpuCoresFields aggregates the first n cores; points with fewer cores count
+// the missing ones as 0.
+func cpuCoresFields(n int) pointFields[types.CPUCoresPoint] {
+	t := pointFields[types.CPUCoresPoint]{at: func(p *types.CPUCoresPoint) *time.Time { return &p.At }}
+	for i := range n {
+		t.fields = append(t.fields, pointField[types.CPUCoresPoint]{
+			name: strconv.Itoa(i),
+			get: func(p types.CPUCoresPoint) float64 {
+				if i < len(p.Cores) {
+					return p.Cores[i]
+				}
+				return 0
+			},
+			set: func(p *types.CPUCoresPoint, v float64) {
+				// The first set replaces the slice shared with the input.
+				if i == 0 {
+					p.Cores = make([]float64, n)
+				}
+				p.Cores[i] = v
+			},
+		})
+	}
+	return t
+}
+
+var sampleFields = pointFields[types.SamplePoint]{
+	at: func(p *types.SamplePoint) *time.Time { return &p.At },
+	fields: []pointField[types.SamplePoint]{{
+		name: "v",
+		get:  func(p types.SamplePoint) float64 { return p.V },
+		set:  func(p *types.SamplePoint, v float64) { p.V = v },
+	}},
+}
+
+func percentile(vals []float64, q float64) float64 {
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+	return sorted[int(q*float64(len(sorted)-1))]
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+func TestDownsample(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pts := []types.DiskPoint{
+		{At: t0.Add(10 * time.Second), Mount: "/", UsedPct: 10, InodesUsed: 100},
+		{At: t0.Add(50 * time.Second), Mount: "/", UsedPct: 20, InodesUsed: 201},
+		{At: t0.Add(70 * time.Second), Mount: "/", UsedPct: 40, InodesUsed: 400},
+	}
+	got := downsample(pts, time.Minute, aggs["avg"], diskFields)
+	// Integers are rounded, as in the store's rollups.
+	want := []types.DiskPoint{
+		{At: t0, Mount: "/", UsedPct: 15, InodesUsed: 151},
+		{At: t0.Add(time.Minute), Mount: "/", UsedPct: 40, InodesUsed: 400},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("downsample =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := downsample(pts, 0, aggs["avg"], diskFields); !reflect.DeepEqual(got, pts) {
+		t.Errorf("step 0 changed the points: %+v", got)
+	}
+}
+
+// TestDownsampleMatchesRollup downsamples raw points to the 5m tier and
+// compares them with the store's rollup of the same points.
+func TestDownsampleMatchesRollup(t *testing.T) {
+	t0 := time.Now().UTC().Add(-time.Hour).Truncate(5 * time.Minute)
+	pts := []types.MemDetailPoint{
+		{At: t0.Add(time.Second), Total: 1000, Used: 100, Cached: 7, MajorFaultsPerSec: 0.5},
+		{At: t0.Add(time.Minute), Total: 1000, Used: 201, Cached: 8, MajorFaultsPerSec: 0.25},
+		{At: t0.Add(5 * time.Minute), Total: 1000, Used: 300, Cached: 9, MajorFaultsPerSec: 1},
+	}
+	m := store.NewMemory()
+	for _, p := range pts {
+		if err := m.SaveMemDetail(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A window this long is answered from the 5m tier.
+	rolled := m.MemDetailBetween(t0.Add(-4*24*time.Hour), t0.Add(10*time.Minute))
+	want := downsample(pts, 5*time.Minute, aggs["avg"], storeFields(func(p *types.MemDetailPoint) *time.Time { return &p.At }))
+	if !reflect.DeepEqual(rolled, want) {
+		t.Errorf("rollup =\n%+v\ndownsample =\n%+v", rolled, want)
+	}
+	if want[0].Used != 151 {
+		t.Errorf("used = %d, want 150.5 rounded to 151", want[0].Used)
+	}
+
+	for _, f := range memFields {
+		if f.name == "" {
+			t.Error("a field of memory_* has no JSON key")
+		}
+	}
+}
+
+func TestDownsampleCores(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pts := []types.CPUCoresPoint{
+		{At: t0, Cores: []float64{10}},
+		{At: t0.Add(time.Second), Cores: []float64{30, 40}},
+	}
+	got := downsample(pts, time.Minute, aggs["max"], cpuCoresFields(2))
+	want := []types.CPUCoresPoint{{At: t0, Cores: []float64{30, 40}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("downsample = %+v, want %+v", got, want)
+	}
+	if pts[0].Cores[0] != 10 {
+		t.Errorf("input modified: %+v", pts[0])
+	}
+}
+
+func TestMemDetails(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pts := []types.MemDetailPoint{
+		{At: t0, Used: 100, Cached: 7, MajorFaultsPerSec: 1},
+		{At: t0.Add(time.Second), Used: 300, Cached: 9, MajorFaultsPerSec: 2},
+	}
+	// used and majorFaultsPerSec.
+	got := memDetails(pts, []int{2, 7}, time.Minute, aggs["sum"])
+	want := []map[string]any{{"t": t0, "used": 400.0, "majorFaultsPerSec": 3.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("memDetails = %v, want %v", got, want)
+	}
+}
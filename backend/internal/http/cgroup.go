@@ -0,0 +1,95 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+)
+
+// cgroupGroup is one cgroup series with its place in the hierarchy.
+type cgroupGroup struct {
+	store.CgroupSeries
+	Parent string `json:"parent,omitempty"`
+	Depth  int    `json:"depth"`
+}
+
+// getCgroups serves per-cgroup series. depth limits how far below the root
+// groups are returned (the root is depth 0); name is a comma-separated list
+// of globs matched against the full path or its last element.
+func (a *App) getCgroups(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	maxDepth := -1
+	if s := q.Get("depth"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("bad depth %q", s), http.StatusBadRequest)
+			return
+		}
+		maxDepth = n
+	}
+	var names []string
+	if s := strings.TrimSpace(q.Get("name")); s != "" {
+		names = strings.Split(s, ",")
+		for _, n := range names {
+			if _, err := path.Match(n, ""); err != nil {
+				http.Error(w, fmt.Sprintf("bad name pattern %q", n), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	out := struct {
+		Range   string        `json:"range"`
+		From    time.Time     `json:"from"`
+		To      time.Time     `json:"to"`
+		Cgroups []cgroupGroup `json:"cgroups"`
+	}{
+		Range:   q.Get("range"),
+		From:    from,
+		To:      to,
+		Cgroups: []cgroupGroup{},
+	}
+	for _, s := range a.Store.CgroupBetween(from, to) {
+		g := cgroupGroup{CgroupSeries: s}
+		if s.Path != "/" {
+			g.Depth = strings.Count(s.Path, "/")
+			g.Parent = path.Dir(s.Path)
+		}
+		if maxDepth >= 0 && g.Depth > maxDepth {
+			continue
+		}
+		if len(names) > 0 && !matchCgroup(names, s.Path) {
+			continue
+		}
+		g.Points = downsample(s.Points, step, agg, cgroupFields)
+		out.Cgroups = append(out.Cgroups, g)
+	}
+	writeJSON(w, out)
+}
+
+func matchCgroup(patterns []string, p string) bool {
+	for _, pat := range patterns {
+		if ok, _ := path.Match(pat, p); ok {
+			return true
+		}
+		if ok, _ := path.Match(pat, path.Base(p)); ok {
+			return true
+		}
+	}
+	return false
+}
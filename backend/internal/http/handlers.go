@@ -2,18 +2,33 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/kebab0o/sysdash/backend/internal/collect"
+	"github.com/kebab0o/sysdash/backend/internal/query"
 	"github.com/kebab0o/sysdash/backend/internal/store"
 	"github.com/kebab0o/sysdash/backend/internal/types"
 )
 
 type App struct {
-	Store *store.Memory
+	Store store.Store
+	// Collectors, when set, backs /api/collectors and the collector series
+	// of /metrics.
+	Collectors *collect.Registry
+	// QueryLimits bound /api/query and /api/query_range; zero fields take
+	// the defaults of package query.
+	QueryLimits query.Limits
 }
 
 func (a *App) Routes() http.Handler {
@@ -22,14 +37,29 @@ func (a *App) Routes() http.Handler {
 	r.Use(CORS, Auth)
 
 	r.Get("/api/health", a.getHealth)
+	r.Get("/metrics", a.getPrometheus)
 
 	r.Route("/api/metrics", func(r chi.Router) {
 		r.Get("/cpu", a.getCPU)
+		r.Get("/load", a.getLoad)
 		r.Get("/mem", a.getMem)
 		r.Get("/disk", a.getDisk)
 		r.Get("/diskio", a.getDiskIO)
+		r.Get("/diskio/devices", a.listDiskDevices)
 		r.Get("/net", a.getNet)
+		r.Get("/pressure", a.getPressure)
+		r.Get("/cgroups", a.getCgroups)
+		r.Get("/sensors", a.getSensors)
+		r.Get("/sockets", a.getSockets)
 	})
+	r.Get("/api/ports", a.getPorts)
+	r.Get("/api/series", a.getSeries)
+	r.Get("/api/query", a.getQuery)
+	r.Get("/api/query_range", a.getQueryRange)
+	r.Get("/api/collectors", a.listCollectors)
+	r.Get("/api/admin/retention", a.getRetention)
+	r.Put("/api/admin/retention", a.putRetention)
+	r.Get("/api/processes", a.getProcesses)
 
 	r.Route("/api/tasks", func(r chi.Router) {
 		r.Get("/", a.listTasks)
@@ -39,6 +69,7 @@ func (a *App) Routes() http.Handler {
 	})
 
 	r.Get("/api/logs", a.listLogs)
+	r.Get("/api/stream", a.stream)
 
 	return r
 }
@@ -52,107 +83,604 @@ func (a *App) getHealth(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, out)
 }
 
-func parseRange(r *http.Request, def string) time.Duration {
-	q := r.URL.Query().Get("range")
-	if q == "" {
-		q = def
+// parseWindow resolves the queried time window. from and to accept RFC3339
+// or unix seconds; without from the window reaches range (def if unset)
+// back from to, which itself defaults to now.
+func parseWindow(r *http.Request, def string) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	to = time.Now().UTC()
+	if s := q.Get("to"); s != "" {
+		if to, err = parseTime(s); err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
 	}
-	d, err := time.ParseDuration(q)
-	if err != nil {
-		switch q {
-		case "1h":
-			return time.Hour
-		case "24h":
-			return 24 * time.Hour
-		default:
-			return time.Hour
+	if s := q.Get("from"); s != "" {
+		if from, err = parseTime(s); err != nil {
+			return from, to, fmt.Errorf("invalid from: %w", err)
+		}
+	} else {
+		rng := q.Get("range")
+		if rng == "" {
+			rng = def
 		}
+		d, err := time.ParseDuration(rng)
+		if err != nil || d <= 0 {
+			return from, to, errors.New("invalid range: want a positive duration such as 1h or 24h")
+		}
+		from = to.Add(-d)
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("invalid window: from must be before to")
 	}
-	return d
+	return from, to, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor unix seconds", s)
 }
 
 func (a *App) getCPU(w http.ResponseWriter, r *http.Request) {
-	d := parseRange(r, "1h")
-	since := time.Now().Add(-d)
-	pts := a.Store.CPUSince(since)
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var withCores, withTimes bool
+	if q := r.URL.Query().Get("detail"); q != "" {
+		for _, d := range strings.Split(q, ",") {
+			switch strings.TrimSpace(d) {
+			case "cores":
+				withCores = true
+			case "times":
+				withTimes = true
+			default:
+				http.Error(w, "invalid detail: want cores, times or both", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	pts := a.Store.CPUBetween(from, to)
 	avg, p95 := calcAvgP(pts)
+	pts = downsample(pts, step, agg, cpuFields)
 
 	out := struct {
-		Range  string           `json:"range"`
-		Points []types.CPUPoint `json:"points"`
-		Avg    float64          `json:"avg"`
-		P95    float64          `json:"p95"`
+		Range  string                `json:"range"`
+		From   time.Time             `json:"from"`
+		To     time.Time             `json:"to"`
+		Points []types.CPUPoint      `json:"points"`
+		Avg    float64               `json:"avg"`
+		P95    float64               `json:"p95"`
+		Cores  []types.CPUCoresPoint `json:"cores,omitempty"`
+		Times  []types.CPUTimesPoint `json:"times,omitempty"`
 	}{
 		Range:  r.URL.Query().Get("range"),
+		From:   from,
+		To:     to,
 		Points: pts,
 		Avg:    avg,
 		P95:    p95,
 	}
+	if withCores {
+		cores := a.Store.CPUCoresBetween(from, to)
+		var n int
+		for _, p := range cores {
+			n = max(n, len(p.Cores))
+		}
+		out.Cores = downsample(cores, step, agg, cpuCoresFields(n))
+	}
+	if withTimes {
+		out.Times = downsample(a.Store.CPUTimesBetween(from, to), step, agg, cpuTimesFields)
+	}
+	writeJSON(w, out)
+}
+
+func (a *App) getLoad(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pts := a.Store.LoadBetween(from, to)
+	pts = downsample(pts, step, agg, loadFields)
+	out := struct {
+		Range  string            `json:"range"`
+		From   time.Time         `json:"from"`
+		To     time.Time         `json:"to"`
+		Points []types.LoadPoint `json:"points"`
+	}{
+		Range:  r.URL.Query().Get("range"),
+		From:   from,
+		To:     to,
+		Points: pts,
+	}
 	writeJSON(w, out)
 }
 
 func (a *App) getMem(w http.ResponseWriter, r *http.Request) {
-	d := parseRange(r, "1h")
-	since := time.Now().Add(-d)
-	pts := a.Store.MemSince(since)
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := parseMemFields(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pts := a.Store.MemBetween(from, to)
 	latest := 0.0
 	if n := len(pts); n > 0 {
 		latest = pts[n-1].V
 	}
+	pts = downsample(pts, step, agg, memPointFields)
 	out := struct {
-		Range  string           `json:"range"`
-		Points []types.MemPoint `json:"points"`
-		Latest float64          `json:"latest"`
+		Range   string           `json:"range"`
+		From    time.Time        `json:"from"`
+		To      time.Time        `json:"to"`
+		Points  []types.MemPoint `json:"points"`
+		Latest  float64          `json:"latest"`
+		Details []map[string]any `json:"details,omitempty"`
 	}{
 		Range:  r.URL.Query().Get("range"),
+		From:   from,
+		To:     to,
 		Points: pts,
 		Latest: latest,
 	}
+	if len(fields) > 0 {
+		out.Details = memDetails(a.Store.MemDetailBetween(from, to), fields, step, agg)
+	}
 	writeJSON(w, out)
 }
 
+// memFields are the fields of types.MemDetailPoint selectable through
+// /api/metrics/mem?fields=, named after their JSON keys.
+var memFields = func() []pointField[types.MemDetailPoint] {
+	keys := map[string]string{
+		"memory_total_bytes":             "total",
+		"memory_available_bytes":         "available",
+		"memory_used_bytes":              "used",
+		"memory_cached_bytes":            "cached",
+		"memory_buffers_bytes":           "buffers",
+		"swap_used_bytes":                "swapUsed",
+		"swap_total_bytes":               "swapTotal",
+		"memory_major_faults_per_second": "majorFaultsPerSec",
+	}
+	fields := storeFields(func(p *types.MemDetailPoint) *time.Time { return &p.At }).fields
+	for i := range fields {
+		fields[i].name = keys[fields[i].name]
+	}
+	return fields
+}()
+
+// parseMemFields returns the indexes into memFields asked for by ?fields=,
+// a comma separated list of field names or "all".
+func parseMemFields(r *http.Request) ([]int, error) {
+	q := strings.TrimSpace(r.URL.Query().Get("fields"))
+	if q == "" {
+		return nil, nil
+	}
+	var out []int
+	for _, name := range strings.Split(q, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			out = out[:0]
+			for i := range memFields {
+				out = append(out, i)
+			}
+			return out, nil
+		}
+		i := slices.IndexFunc(memFields, func(f pointField[types.MemDetailPoint]) bool { return f.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("invalid field %q: want all or one of total, available, used, cached, buffers, swapUsed, swapTotal, majorFaultsPerSec", name)
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+func memDetails(pts []types.MemDetailPoint, fields []int, step time.Duration, agg aggFunc) []map[string]any {
+	t := pointFields[types.MemDetailPoint]{at: func(p *types.MemDetailPoint) *time.Time { return &p.At }}
+	for _, f := range fields {
+		t.fields = append(t.fields, memFields[f])
+	}
+	pts = downsample(pts, step, agg, t)
+
+	out := make([]map[string]any, len(pts))
+	for i, p := range pts {
+		row := map[string]any{"t": p.At}
+		for _, f := range t.fields {
+			row[f.name] = f.get(p)
+		}
+		out[i] = row
+	}
+	return out
+}
+
 func (a *App) getDisk(w http.ResponseWriter, r *http.Request) {
-	d := parseRange(r, "24h")
-	since := time.Now().Add(-d)
-	series := a.Store.DiskSince(since)
+	from, to, err := parseWindow(r, "24h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series := a.Store.DiskBetween(from, to)
+	for i := range series {
+		series[i].Points = downsample(series[i].Points, step, agg, diskFields)
+	}
 	out := struct {
 		Range  string             `json:"range"`
+		From   time.Time          `json:"from"`
+		To     time.Time          `json:"to"`
 		Mounts []store.DiskSeries `json:"mounts"`
 	}{
 		Range:  r.URL.Query().Get("range"),
+		From:   from,
+		To:     to,
 		Mounts: series,
 	}
 	writeJSON(w, out)
 }
 
 func (a *App) getDiskIO(w http.ResponseWriter, r *http.Request) {
-	d := parseRange(r, "1h")
-	since := time.Now().Add(-d)
-	pts := a.Store.DiskIOSince(since)
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pts := a.Store.DiskIOBetween(from, to)
+	pts = downsample(pts, step, agg, diskIOFields)
 	out := struct {
-		Range  string              `json:"range"`
-		Points []types.DiskIOPoint `json:"points"`
+		Range   string                   `json:"range"`
+		From    time.Time                `json:"from"`
+		To      time.Time                `json:"to"`
+		Points  []types.DiskIOPoint      `json:"points"`
+		Devices []store.DiskDeviceSeries `json:"devices,omitempty"`
 	}{
 		Range:  r.URL.Query().Get("range"),
+		From:   from,
+		To:     to,
 		Points: pts,
 	}
+	if q := strings.TrimSpace(r.URL.Query().Get("device")); q != "" {
+		want := strings.Split(q, ",")
+		for _, s := range a.Store.DiskDeviceBetween(from, to) {
+			if q != "*" && !slices.Contains(want, s.Device) {
+				continue
+			}
+			s.Points = downsample(s.Points, step, agg, diskDeviceFields)
+			out.Devices = append(out.Devices, s)
+		}
+	}
 	writeJSON(w, out)
 }
 
+func (a *App) listDiskDevices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.Store.DiskDevices())
+}
+
 func (a *App) getNet(w http.ResponseWriter, r *http.Request) {
-	d := parseRange(r, "1h")
-	since := time.Now().Add(-d)
-	pts := a.Store.NetSince(since)
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pts := a.Store.NetBetween(from, to)
+	pts = downsample(pts, step, agg, netFields)
 	out := struct {
-		Range  string           `json:"range"`
-		Points []types.NetPoint `json:"points"`
+		Range      string                 `json:"range"`
+		From       time.Time              `json:"from"`
+		To         time.Time              `json:"to"`
+		Points     []types.NetPoint       `json:"points"`
+		Interfaces []store.NetIfaceSeries `json:"interfaces,omitempty"`
 	}{
 		Range:  r.URL.Query().Get("range"),
+		From:   from,
+		To:     to,
 		Points: pts,
 	}
+	if q := strings.TrimSpace(r.URL.Query().Get("iface")); q != "" {
+		want := strings.Split(q, ",")
+		for _, s := range a.Store.NetIfaceBetween(from, to) {
+			if q != "*" && !slices.Contains(want, s.Iface) {
+				continue
+			}
+			s.Points = downsample(s.Points, step, agg, netIfaceFields)
+			out.Interfaces = append(out.Interfaces, s)
+		}
+	}
+	writeJSON(w, out)
+}
+
+// getPressure serves pressure-stall series. Supported is false when no
+// resource has ever been recorded, i.e. the kernel lacks PSI.
+func (a *App) getPressure(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out := struct {
+		Range     string                 `json:"range"`
+		From      time.Time              `json:"from"`
+		To        time.Time              `json:"to"`
+		Supported bool                   `json:"supported"`
+		Resources []store.PressureSeries `json:"resources"`
+	}{
+		Range:     r.URL.Query().Get("range"),
+		From:      from,
+		To:        to,
+		Supported: len(a.Store.PressureResources()) > 0,
+		Resources: []store.PressureSeries{},
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("resource"))
+	want := strings.Split(q, ",")
+	for _, s := range a.Store.PressureBetween(from, to) {
+		if q != "" && q != "*" && !slices.Contains(want, s.Resource) {
+			continue
+		}
+		s.Points = downsample(s.Points, step, agg, pressureFields)
+		out.Resources = append(out.Resources, s)
+	}
+	writeJSON(w, out)
+}
+
+// getSensors serves temperature and fan series, optionally limited to one
+// kind (temp or fan) and to a comma-separated list of chips.
+func (a *App) getSensors(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	kind := q.Get("kind")
+	if kind != "" && kind != "temp" && kind != "fan" {
+		http.Error(w, fmt.Sprintf("bad kind %q, want temp or fan", kind), http.StatusBadRequest)
+		return
+	}
+	chips := strings.TrimSpace(q.Get("chip"))
+	want := strings.Split(chips, ",")
+
+	out := struct {
+		Range   string               `json:"range"`
+		From    time.Time            `json:"from"`
+		To      time.Time            `json:"to"`
+		Sensors []store.SensorSeries `json:"sensors"`
+	}{
+		Range:   q.Get("range"),
+		From:    from,
+		To:      to,
+		Sensors: []store.SensorSeries{},
+	}
+	for _, s := range a.Store.SensorBetween(from, to) {
+		if kind != "" && s.Kind != kind {
+			continue
+		}
+		if chips != "" && !slices.Contains(want, s.Chip) {
+			continue
+		}
+		s.Points = downsample(s.Points, step, agg, sensorFields)
+		out.Sensors = append(out.Sensors, s)
+	}
+	writeJSON(w, out)
+}
+
+// getSockets serves socket counts per protocol and state, optionally limited
+// to comma-separated lists of protocols and states.
+func (a *App) getSockets(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	protos, states := strings.TrimSpace(q.Get("protocol")), strings.TrimSpace(strings.ToUpper(q.Get("state")))
+	out := struct {
+		Range   string               `json:"range"`
+		From    time.Time            `json:"from"`
+		To      time.Time            `json:"to"`
+		Sockets []store.SocketSeries `json:"sockets"`
+	}{
+		Range:   q.Get("range"),
+		From:    from,
+		To:      to,
+		Sockets: []store.SocketSeries{},
+	}
+	for _, s := range a.Store.SocketBetween(from, to) {
+		if protos != "" && !slices.Contains(strings.Split(protos, ","), s.Protocol) {
+			continue
+		}
+		if states != "" && !slices.Contains(strings.Split(states, ","), s.State) {
+			continue
+		}
+		s.Points = downsample(s.Points, step, agg, socketFields)
+		out.Sockets = append(out.Sockets, s)
+	}
+	writeJSON(w, out)
+}
+
+// getPorts serves the latest listening-port inventory, optionally limited to
+// one protocol.
+func (a *App) getPorts(w http.ResponseWriter, r *http.Request) {
+	snap := a.Store.Ports()
+	if proto := r.URL.Query().Get("protocol"); proto != "" {
+		ports := snap.Ports[:0]
+		for _, p := range snap.Ports {
+			if p.Protocol == proto {
+				ports = append(ports, p)
+			}
+		}
+		snap.Ports = ports
+	}
+	if snap.Ports == nil {
+		snap.Ports = []types.ListeningPort{}
+	}
+	writeJSON(w, snap)
+}
+
+type collectorStats struct {
+	Name            string    `json:"name"`
+	Enabled         bool      `json:"enabled"`
+	IntervalSeconds float64   `json:"intervalSeconds"`
+	TimeoutSeconds  float64   `json:"timeoutSeconds"`
+	Running         bool      `json:"running"`
+	Runs            uint64    `json:"runs"`
+	Errors          uint64    `json:"errors"`
+	Timeouts        uint64    `json:"timeouts"`
+	Skipped         uint64    `json:"skipped"`
+	LastRun         time.Time `json:"lastRun,omitzero"`
+	LastDurationMs  float64   `json:"lastDurationMs"`
+	LastError       string    `json:"lastError,omitempty"`
+	LastErrorAt     time.Time `json:"lastErrorAt,omitzero"`
+}
+
+func (a *App) listCollectors(w http.ResponseWriter, r *http.Request) {
+	out := []collectorStats{}
+	if a.Collectors != nil {
+		for _, s := range a.Collectors.Stats() {
+			out = append(out, collectorStats{
+				Name:            s.Name,
+				Enabled:         s.Enabled,
+				IntervalSeconds: s.Interval.Seconds(),
+				TimeoutSeconds:  s.Timeout.Seconds(),
+				Running:         s.Running,
+				Runs:            s.Runs,
+				Errors:          s.Errors,
+				Timeouts:        s.Timeouts,
+				Skipped:         s.Skipped,
+				LastRun:         s.LastRun,
+				LastDurationMs:  float64(s.LastDuration) / float64(time.Millisecond),
+				LastError:       s.LastError,
+				LastErrorAt:     s.LastErrorAt,
+			})
+		}
+	}
+	writeJSON(w, out)
+}
+
+type retentionStats struct {
+	Family  string      `json:"family"`
+	RingCap int         `json:"ringCap"`
+	Series  int         `json:"series"`
+	Tiers   []tierStats `json:"tiers"`
+}
+
+type tierStats struct {
+	Tier             string    `json:"tier"`
+	StepSeconds      float64   `json:"stepSeconds"`
+	RetentionSeconds float64   `json:"retentionSeconds"`
+	Oldest           time.Time `json:"oldest,omitzero"`
+}
+
+func (a *App) getRetention(w http.ResponseWriter, r *http.Request) {
+	out := []retentionStats{}
+	for _, s := range a.Store.RetentionStatus() {
+		rs := retentionStats{Family: s.Family, RingCap: s.RingCap, Series: s.Series, Tiers: []tierStats{}}
+		for _, t := range s.Tiers {
+			rs.Tiers = append(rs.Tiers, tierStats{
+				Tier:             t.Name,
+				StepSeconds:      t.Step.Seconds(),
+				RetentionSeconds: t.Keep.Seconds(),
+				Oldest:           t.Oldest,
+			})
+		}
+		out = append(out, rs)
+	}
 	writeJSON(w, out)
 }
 
+// putRetention changes the policies of the families in the body, which has
+// the shape getRetention returns: every tier of a family, in order, with
+// its retentionSeconds, and its ringCap. Series counts, steps and oldest
+// times are ignored; families left out keep their policy. The change is
+// saved with the store and outlives a restart.
+func (a *App) putRetention(w http.ResponseWriter, r *http.Request) {
+	var body []retentionStats
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	policies := store.Retention{}
+	tierNames := map[string][]string{}
+	for _, s := range a.Store.RetentionStatus() {
+		p := store.Policy{RingCap: s.RingCap}
+		for _, t := range s.Tiers {
+			p.Keep = append(p.Keep, t.Keep)
+			tierNames[s.Family] = append(tierNames[s.Family], t.Name)
+		}
+		policies[s.Family] = p
+	}
+	for _, rs := range body {
+		p := store.Policy{RingCap: rs.RingCap}
+		for i, t := range rs.Tiers {
+			if names := tierNames[rs.Family]; i < len(names) && t.Tier != "" && t.Tier != names[i] {
+				http.Error(w, fmt.Sprintf("%s: tier %d is %s, not %s", rs.Family, i, names[i], t.Tier), http.StatusBadRequest)
+				return
+			}
+			p.Keep = append(p.Keep, time.Duration(t.RetentionSeconds*float64(time.Second)))
+		}
+		policies[rs.Family] = p
+	}
+	if err := a.Store.SetRetention(policies); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.getRetention(w, r)
+}
+
 func (a *App) listTasks(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, a.Store.ListTasks())
 }
@@ -195,7 +723,17 @@ func (a *App) deleteTask(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *App) listLogs(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, a.Store.ListLogs(300, r.URL.Query().Get("q")))
+	q := r.URL.Query()
+	if q.Get("from") == "" && q.Get("to") == "" && q.Get("range") == "" {
+		writeJSON(w, a.Store.ListLogs(300, q.Get("q")))
+		return
+	}
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, a.Store.LogsBetween(from, to, 300, q.Get("q")))
 }
 
 func writeJSON(w http.ResponseWriter, v any) {
@@ -228,3 +766,87 @@ func calcAvgP(pts []types.CPUPoint) (avg, p95 float64) {
 	p95 = values[idx]
 	return
 }
+
+const (
+	defaultSeriesLimit = 100
+	maxSeriesLimit     = 1000
+)
+
+// parsePage reads limit and offset. limit defaults to defaultSeriesLimit
+// and cannot exceed maxSeriesLimit.
+func parsePage(q url.Values) (limit, offset int, err error) {
+	limit = defaultSeriesLimit
+	if s := q.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > maxSeriesLimit {
+			return 0, 0, fmt.Errorf("bad limit %q: want 1 to %d", s, maxSeriesLimit)
+		}
+	}
+	if s := q.Get("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("bad offset %q", s)
+		}
+	}
+	return limit, offset, nil
+}
+
+// getSeries serves generic series: those of exec collectors as well as the
+// per-field series every builtin metric is stored as. name selects one
+// metric, and a series is returned only if every match=label=value pair
+// holds for it; an empty value matches series without the label. Series
+// come a page of at most limit at a time, and only the page is loaded.
+func (a *App) getSeries(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, agg, err := parseStep(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	limit, offset, err := parsePage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ms []types.Matcher
+	if name := q.Get("name"); name != "" {
+		ms = append(ms, types.Matcher{Name: types.NameLabel, Value: name})
+	}
+	for _, m := range q["match"] {
+		k, v, ok := strings.Cut(m, "=")
+		if !ok || k == "" {
+			http.Error(w, fmt.Sprintf("bad match %q, want label=value", m), http.StatusBadRequest)
+			return
+		}
+		ms = append(ms, types.Matcher{Name: k, Value: v})
+	}
+
+	page, total, err := a.Store.SelectPage(from, to, store.SelectOptions{Offset: offset, Limit: limit}, ms...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := struct {
+		Range  string         `json:"range"`
+		From   time.Time      `json:"from"`
+		To     time.Time      `json:"to"`
+		Total  int            `json:"total"`
+		Offset int            `json:"offset"`
+		Series []types.Series `json:"series"`
+	}{
+		Range:  q.Get("range"),
+		From:   from,
+		To:     to,
+		Total:  total,
+		Offset: offset,
+		Series: []types.Series{},
+	}
+	for _, s := range page {
+		s.Points = downsample(s.Points, step, agg, sampleFields)
+		out.Series = append(out.Series, s)
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// processSorts maps the sort parameter of /api/processes to a "less" order.
+// Numeric columns sort descending, pid and name ascending.
+var processSorts = map[string]func(a, b types.ProcessInfo) bool{
+	"cpu":     func(a, b types.ProcessInfo) bool { return a.CPUPct > b.CPUPct },
+	"rss":     func(a, b types.ProcessInfo) bool { return a.RSSBytes > b.RSSBytes },
+	"threads": func(a, b types.ProcessInfo) bool { return a.Threads > b.Threads },
+	"fds":     func(a, b types.ProcessInfo) bool { return a.FDs > b.FDs },
+	"read":    func(a, b types.ProcessInfo) bool { return a.ReadBytes > b.ReadBytes },
+	"write":   func(a, b types.ProcessInfo) bool { return a.WriteBytes > b.WriteBytes },
+	"pid":     func(a, b types.ProcessInfo) bool { return a.PID < b.PID },
+	"name":    func(a, b types.ProcessInfo) bool { return a.Name < b.Name },
+}
+
+func (a *App) getProcesses(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	at := time.Now().UTC()
+	if s := q.Get("at"); s != "" {
+		t, err := parseTime(s)
+		if err != nil {
+			http.Error(w, "bad at: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+	by := q.Get("sort")
+	if by == "" {
+		by = "cpu"
+	}
+	less, ok := processSorts[by]
+	if !ok {
+		http.Error(w, fmt.Sprintf("bad sort %q", by), http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("bad limit %q", s), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	snap, ok := a.Store.ProcessesAt(at)
+	if !ok {
+		http.Error(w, "no process snapshot at or before "+at.Format(time.RFC3339), http.StatusNotFound)
+		return
+	}
+	text, user := strings.ToLower(q.Get("q")), q.Get("user")
+	procs := snap.Processes[:0]
+	for _, p := range snap.Processes {
+		if user != "" && p.User != user {
+			continue
+		}
+		if text != "" && !strings.Contains(strings.ToLower(p.Name), text) && !strings.Contains(strings.ToLower(p.Cmdline), text) {
+			continue
+		}
+		procs = append(procs, p)
+	}
+	sort.SliceStable(procs, func(i, j int) bool { return less(procs[i], procs[j]) })
+	if limit > 0 && len(procs) > limit {
+		procs = procs[:limit]
+	}
+	snap.Processes = procs
+	writeJSON(w, snap)
+}
@@ -0,0 +1,376 @@
+package http
+
+import (
+	"bytes"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/collect"
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// latestWindow is how far before the last collector run /metrics looks for
+// the most recent sample of each builtin series, and at least as far for
+// exec series.
+const latestWindow = 5 * time.Minute
+
+// getPrometheus serves the latest collected values in the Prometheus text
+// exposition format.
+func (a *App) getPrometheus(w http.ResponseWriter, r *http.Request) {
+	var p promWriter
+	last := a.Store.LastCollector()
+
+	p.family("sysdash_collector_last_run_timestamp_seconds", "Unix time of the last completed collector run.", "gauge")
+	if !last.IsZero() {
+		p.sample("sysdash_collector_last_run_timestamp_seconds", unixSeconds(last))
+	}
+	p.family("sysdash_store_out_of_order_samples_total", "Samples dropped for being older than the newest sample of their series.", "counter")
+	p.sample("sysdash_store_out_of_order_samples_total", float64(a.Store.OutOfOrderSamples()))
+
+	if !last.IsZero() {
+		from := last.Add(-latestWindow)
+
+		p.family("sysdash_cpu_usage_ratio", "CPU utilisation across all cores.", "gauge")
+		if pts := a.Store.CPUBetween(from, last); len(pts) > 0 {
+			p.sample("sysdash_cpu_usage_ratio", pts[len(pts)-1].V/100)
+		}
+
+		if pts := a.Store.CPUCoresBetween(from, last); len(pts) > 0 {
+			p.family("sysdash_cpu_core_usage_ratio", "Utilisation of one logical core.", "gauge")
+			for i, v := range pts[len(pts)-1].Cores {
+				p.sample("sysdash_cpu_core_usage_ratio", v/100, "core", strconv.Itoa(i))
+			}
+		}
+		if pts := a.Store.CPUTimesBetween(from, last); len(pts) > 0 {
+			t := pts[len(pts)-1]
+			p.family("sysdash_cpu_time_ratio", "Share of CPU time spent in each mode since the previous sample.", "gauge")
+			for _, m := range []struct {
+				mode string
+				v    float64
+			}{
+				{"user", t.User}, {"nice", t.Nice}, {"system", t.System}, {"idle", t.Idle},
+				{"iowait", t.Iowait}, {"irq", t.Irq}, {"softirq", t.Softirq}, {"steal", t.Steal},
+			} {
+				p.sample("sysdash_cpu_time_ratio", m.v/100, "mode", m.mode)
+			}
+		}
+		if pts := a.Store.LoadBetween(from, last); len(pts) > 0 {
+			l := pts[len(pts)-1]
+			p.family("sysdash_load1", "1-minute load average.", "gauge")
+			p.sample("sysdash_load1", l.Load1)
+			p.family("sysdash_load5", "5-minute load average.", "gauge")
+			p.sample("sysdash_load5", l.Load5)
+			p.family("sysdash_load15", "15-minute load average.", "gauge")
+			p.sample("sysdash_load15", l.Load15)
+		}
+
+		p.family("sysdash_memory_used_ratio", "Used share of physical memory.", "gauge")
+		if pts := a.Store.MemBetween(from, last); len(pts) > 0 {
+			p.sample("sysdash_memory_used_ratio", pts[len(pts)-1].V/100)
+		}
+
+		if pts := a.Store.MemDetailBetween(from, last); len(pts) > 0 {
+			d := pts[len(pts)-1]
+			for _, g := range []struct {
+				name, help string
+				v          float64
+			}{
+				{"sysdash_memory_total_bytes", "Physical memory size.", float64(d.Total)},
+				{"sysdash_memory_available_bytes", "Memory available without swapping.", float64(d.Available)},
+				{"sysdash_memory_used_bytes", "Used physical memory.", float64(d.Used)},
+				{"sysdash_memory_cached_bytes", "Page cache size.", float64(d.Cached)},
+				{"sysdash_memory_buffers_bytes", "Kernel buffer size.", float64(d.Buffers)},
+				{"sysdash_swap_used_bytes", "Used swap space.", float64(d.SwapUsed)},
+				{"sysdash_swap_size_bytes", "Swap space size.", float64(d.SwapTotal)},
+				{"sysdash_memory_major_faults_per_second", "Major page-fault rate.", d.MajorFaultsPerSec},
+			} {
+				p.family(g.name, g.help, "gauge")
+				p.sample(g.name, g.v)
+			}
+		}
+
+		disks := a.Store.DiskBetween(from, last)
+		p.family("sysdash_filesystem_used_ratio", "Used share of the filesystem.", "gauge")
+		for _, d := range disks {
+			p.sample("sysdash_filesystem_used_ratio", d.Points[len(d.Points)-1].UsedPct/100, "mount", d.Mount)
+		}
+		p.family("sysdash_filesystem_used_bytes", "Used filesystem space in bytes.", "gauge")
+		for _, d := range disks {
+			p.sample("sysdash_filesystem_used_bytes", d.Points[len(d.Points)-1].UsedGB*gib, "mount", d.Mount)
+		}
+		p.family("sysdash_filesystem_size_bytes", "Filesystem size in bytes.", "gauge")
+		for _, d := range disks {
+			p.sample("sysdash_filesystem_size_bytes", d.Points[len(d.Points)-1].TotalGB*gib, "mount", d.Mount)
+		}
+		p.family("sysdash_filesystem_inodes_used", "Used inodes.", "gauge")
+		for _, d := range disks {
+			p.sample("sysdash_filesystem_inodes_used", float64(d.Points[len(d.Points)-1].InodesUsed), "mount", d.Mount)
+		}
+		p.family("sysdash_filesystem_inodes_free", "Free inodes.", "gauge")
+		for _, d := range disks {
+			p.sample("sysdash_filesystem_inodes_free", float64(d.Points[len(d.Points)-1].InodesFree), "mount", d.Mount)
+		}
+		p.family("sysdash_filesystem_inodes_used_ratio", "Used share of the inodes.", "gauge")
+		for _, d := range disks {
+			p.sample("sysdash_filesystem_inodes_used_ratio", d.Points[len(d.Points)-1].InodesUsedPct/100, "mount", d.Mount)
+		}
+
+		if pts := a.Store.DiskIOBetween(from, last); len(pts) > 0 {
+			io := pts[len(pts)-1]
+			p.family("sysdash_disk_read_bytes_per_second", "Disk read throughput.", "gauge")
+			p.sample("sysdash_disk_read_bytes_per_second", io.ReadMBs*mib)
+			p.family("sysdash_disk_written_bytes_per_second", "Disk write throughput.", "gauge")
+			p.sample("sysdash_disk_written_bytes_per_second", io.WriteMBs*mib)
+		}
+
+		devices := a.Store.DiskDeviceBetween(from, last)
+		for _, g := range []struct {
+			name, help string
+			get        func(types.DiskDevicePoint) float64
+		}{
+			{"sysdash_disk_device_read_bytes_per_second", "Bytes read per second.", func(p types.DiskDevicePoint) float64 { return p.ReadBytes }},
+			{"sysdash_disk_device_written_bytes_per_second", "Bytes written per second.", func(p types.DiskDevicePoint) float64 { return p.WriteBytes }},
+			{"sysdash_disk_device_reads_per_second", "Completed reads per second.", func(p types.DiskDevicePoint) float64 { return p.ReadIOPS }},
+			{"sysdash_disk_device_writes_per_second", "Completed writes per second.", func(p types.DiskDevicePoint) float64 { return p.WriteIOPS }},
+			{"sysdash_disk_device_await_seconds", "Average time an IO took to complete.", func(p types.DiskDevicePoint) float64 { return p.AwaitMs / 1000 }},
+			{"sysdash_disk_device_busy_ratio", "Share of time the device had IO in flight.", func(p types.DiskDevicePoint) float64 { return p.UtilPct / 100 }},
+		} {
+			if len(devices) == 0 {
+				break
+			}
+			p.family(g.name, g.help, "gauge")
+			for _, s := range devices {
+				p.sample(g.name, g.get(s.Points[len(s.Points)-1]), "device", s.Device)
+			}
+		}
+
+		if pts := a.Store.NetBetween(from, last); len(pts) > 0 {
+			n := pts[len(pts)-1]
+			p.family("sysdash_network_receive_bytes_per_second", "Network receive throughput.", "gauge")
+			p.sample("sysdash_network_receive_bytes_per_second", n.RxKBs*kib)
+			p.family("sysdash_network_transmit_bytes_per_second", "Network transmit throughput.", "gauge")
+			p.sample("sysdash_network_transmit_bytes_per_second", n.TxKBs*kib)
+		}
+
+		ifaces := a.Store.NetIfaceBetween(from, last)
+		for _, g := range []struct {
+			name, help string
+			get        func(types.NetIfacePoint) float64
+		}{
+			{"sysdash_network_interface_receive_bytes_per_second", "Bytes received per second.", func(p types.NetIfacePoint) float64 { return p.RxBytes }},
+			{"sysdash_network_interface_transmit_bytes_per_second", "Bytes sent per second.", func(p types.NetIfacePoint) float64 { return p.TxBytes }},
+			{"sysdash_network_interface_receive_packets_per_second", "Packets received per second.", func(p types.NetIfacePoint) float64 { return p.RxPackets }},
+			{"sysdash_network_interface_transmit_packets_per_second", "Packets sent per second.", func(p types.NetIfacePoint) float64 { return p.TxPackets }},
+			{"sysdash_network_interface_receive_errors_per_second", "Receive errors per second.", func(p types.NetIfacePoint) float64 { return p.RxErrors }},
+			{"sysdash_network_interface_transmit_errors_per_second", "Transmit errors per second.", func(p types.NetIfacePoint) float64 { return p.TxErrors }},
+			{"sysdash_network_interface_receive_drops_per_second", "Dropped incoming packets per second.", func(p types.NetIfacePoint) float64 { return p.RxDrops }},
+			{"sysdash_network_interface_transmit_drops_per_second", "Dropped outgoing packets per second.", func(p types.NetIfacePoint) float64 { return p.TxDrops }},
+		} {
+			if len(ifaces) == 0 {
+				break
+			}
+			p.family(g.name, g.help, "gauge")
+			for _, s := range ifaces {
+				p.sample(g.name, g.get(s.Points[len(s.Points)-1]), "iface", s.Iface)
+			}
+		}
+
+		var temps, fans []store.SensorSeries
+		for _, s := range a.Store.SensorBetween(from, last) {
+			if s.Kind == "fan" {
+				fans = append(fans, s)
+			} else {
+				temps = append(temps, s)
+			}
+		}
+		if len(temps) > 0 {
+			p.family("sysdash_sensor_temperature_celsius", "Temperature reported by a hardware sensor.", "gauge")
+			for _, s := range temps {
+				p.sample("sysdash_sensor_temperature_celsius", s.Points[len(s.Points)-1].Value, "chip", s.Chip, "sensor", s.Label)
+			}
+			p.family("sysdash_sensor_temperature_critical_celsius", "Critical temperature threshold of a hardware sensor.", "gauge")
+			for _, s := range temps {
+				if c := s.Points[len(s.Points)-1].Crit; c > 0 {
+					p.sample("sysdash_sensor_temperature_critical_celsius", c, "chip", s.Chip, "sensor", s.Label)
+				}
+			}
+		}
+		if len(fans) > 0 {
+			p.family("sysdash_sensor_fan_rpm", "Fan speed in revolutions per minute.", "gauge")
+			for _, s := range fans {
+				p.sample("sysdash_sensor_fan_rpm", s.Points[len(s.Points)-1].Value, "chip", s.Chip, "sensor", s.Label)
+			}
+		}
+
+		if sockets := a.Store.SocketBetween(from, last); len(sockets) > 0 {
+			p.family("sysdash_sockets", "Open sockets by protocol and state.", "gauge")
+			for _, s := range sockets {
+				p.sample("sysdash_sockets", float64(s.Points[len(s.Points)-1].Count), "protocol", s.Protocol, "state", s.State)
+			}
+		}
+
+		pressure := a.Store.PressureBetween(from, last)
+		for _, g := range []struct {
+			name, help string
+			get        func(types.PressurePoint) float64
+		}{
+			{"sysdash_pressure_some_avg10_ratio", "Share of the last 10s some tasks stalled on the resource.", func(p types.PressurePoint) float64 { return p.SomeAvg10 / 100 }},
+			{"sysdash_pressure_some_avg60_ratio", "Share of the last 60s some tasks stalled on the resource.", func(p types.PressurePoint) float64 { return p.SomeAvg60 / 100 }},
+			{"sysdash_pressure_some_avg300_ratio", "Share of the last 300s some tasks stalled on the resource.", func(p types.PressurePoint) float64 { return p.SomeAvg300 / 100 }},
+			{"sysdash_pressure_full_avg10_ratio", "Share of the last 10s all non-idle tasks stalled on the resource.", func(p types.PressurePoint) float64 { return p.FullAvg10 / 100 }},
+			{"sysdash_pressure_full_avg60_ratio", "Share of the last 60s all non-idle tasks stalled on the resource.", func(p types.PressurePoint) float64 { return p.FullAvg60 / 100 }},
+			{"sysdash_pressure_full_avg300_ratio", "Share of the last 300s all non-idle tasks stalled on the resource.", func(p types.PressurePoint) float64 { return p.FullAvg300 / 100 }},
+		} {
+			if len(pressure) == 0 {
+				break
+			}
+			p.family(g.name, g.help, "gauge")
+			for _, s := range pressure {
+				p.sample(g.name, g.get(s.Points[len(s.Points)-1]), "resource", s.Resource)
+			}
+		}
+		for _, c := range []struct {
+			name, help string
+			get        func(types.PressurePoint) uint64
+		}{
+			{"sysdash_pressure_some_stalled_seconds_total", "Total time some tasks stalled on the resource.", func(p types.PressurePoint) uint64 { return p.SomeTotal }},
+			{"sysdash_pressure_full_stalled_seconds_total", "Total time all non-idle tasks stalled on the resource.", func(p types.PressurePoint) uint64 { return p.FullTotal }},
+		} {
+			if len(pressure) == 0 {
+				break
+			}
+			p.family(c.name, c.help, "counter")
+			for _, s := range pressure {
+				p.sample(c.name, float64(c.get(s.Points[len(s.Points)-1]))/1e6, "resource", s.Resource)
+			}
+		}
+
+		// Series from exec collectors, which always carry a job label, are
+		// passed through under their own names. They come sorted by name, so
+		// each family is contiguous. An exec collector may run far less often
+		// than the builtin ones, so its series are looked up over twice its
+		// interval.
+		windows := map[string]time.Duration{}
+		widest := latestWindow
+		if a.Collectors != nil {
+			for _, st := range a.Collectors.Stats() {
+				if job, ok := strings.CutPrefix(st.Name, "exec:"); ok {
+					windows[job] = max(latestWindow, 2*st.Interval)
+					widest = max(widest, windows[job])
+				}
+			}
+		}
+		prev := ""
+		for _, s := range a.Store.Select(last.Add(-widest), last) {
+			job := s.Labels["job"]
+			if job == "" || strings.HasPrefix(s.Name, collect.ReservedPrefix) {
+				continue
+			}
+			window, ok := windows[job]
+			if !ok {
+				window = latestWindow
+			}
+			if s.Points[len(s.Points)-1].At.Before(last.Add(-window)) {
+				continue
+			}
+			if s.Name != prev {
+				p.family(s.Name, "Reported by an exec collector.", "untyped")
+				prev = s.Name
+			}
+			keys := slices.Sorted(maps.Keys(s.Labels))
+			labels := make([]string, 0, 2*len(keys))
+			for _, k := range keys {
+				labels = append(labels, k, s.Labels[k])
+			}
+			p.sample(s.Name, s.Points[len(s.Points)-1].V, labels...)
+		}
+	}
+
+	if a.Collectors != nil {
+		stats := a.Collectors.Stats()
+		for _, g := range []struct {
+			name, help, typ string
+			get             func(collect.Stats) float64
+		}{
+			{"sysdash_collector_enabled", "Whether the collector is enabled.", "gauge", func(s collect.Stats) float64 { return boolFloat(s.Enabled) }},
+			{"sysdash_collector_runs_total", "Completed or timed-out runs of the collector.", "counter", func(s collect.Stats) float64 { return float64(s.Runs) }},
+			{"sysdash_collector_errors_total", "Runs of the collector that failed or timed out.", "counter", func(s collect.Stats) float64 { return float64(s.Errors) }},
+			{"sysdash_collector_timeouts_total", "Runs of the collector that timed out.", "counter", func(s collect.Stats) float64 { return float64(s.Timeouts) }},
+			{"sysdash_collector_skipped_total", "Runs skipped because the previous one had not returned.", "counter", func(s collect.Stats) float64 { return float64(s.Skipped) }},
+			{"sysdash_collector_last_duration_seconds", "Duration of the last run of the collector.", "gauge", func(s collect.Stats) float64 { return s.LastDuration.Seconds() }},
+		} {
+			p.family(g.name, g.help, g.typ)
+			for _, s := range stats {
+				p.sample(g.name, g.get(s), "collector", s.Name)
+			}
+		}
+	}
+
+	tasks := a.Store.ListTasks()
+	p.family("sysdash_task_enabled", "Whether the task is scheduled.", "gauge")
+	for _, t := range tasks {
+		p.sample("sysdash_task_enabled", boolFloat(t.Enabled), "id", t.ID, "task", t.Name)
+	}
+	p.family("sysdash_task_last_run_ok", "Whether the last run of the task succeeded (1) or failed (0).", "gauge")
+	for _, t := range tasks {
+		if t.Status != "" {
+			p.sample("sysdash_task_last_run_ok", boolFloat(t.Status == "OK"), "id", t.ID, "task", t.Name)
+		}
+	}
+	p.family("sysdash_task_last_run_timestamp_seconds", "Unix time of the last run of the task.", "gauge")
+	for _, t := range tasks {
+		if !t.LastRun.IsZero() {
+			p.sample("sysdash_task_last_run_timestamp_seconds", unixSeconds(t.LastRun), "id", t.ID, "task", t.Name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(p.buf.Bytes())
+}
+
+const (
+	kib = 1024.0
+	mib = 1024.0 * 1024.0
+	gib = 1024.0 * 1024.0 * 1024.0
+)
+
+type promWriter struct {
+	buf bytes.Buffer
+}
+
+func (p *promWriter) family(name, help, typ string) {
+	p.buf.WriteString("# HELP " + name + " " + help + "\n")
+	p.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one sample; labels alternate between name and value.
+func (p *promWriter) sample(name string, v float64, labels ...string) {
+	p.buf.WriteString(name)
+	if len(labels) > 0 {
+		p.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			p.buf.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+		}
+		p.buf.WriteByte('}')
+	}
+	p.buf.WriteString(" " + strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func unixSeconds(t time.Time) float64 { return float64(t.UnixNano()) / 1e9 }
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
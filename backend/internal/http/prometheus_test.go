@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/collect"
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestPrometheusGolden(t *testing.T) {
+	m := store.NewMemory()
+	// The store picks its rollup tier relative to the wall clock, so the
+	// samples are recent and their timestamp is masked in the output.
+	last := time.Now().UTC().Truncate(time.Second)
+	at := last.Add(-10 * time.Second)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(m.SaveCPU(types.CPUPoint{At: at, V: 42.5}))
+	must(m.SaveLoad(types.LoadPoint{At: at, Load1: 0.5, Load5: 0.25, Load15: 0.125}))
+	must(m.SaveMem(types.MemPoint{At: at, V: 60}))
+	must(m.SaveDisk(types.DiskPoint{At: at, Mount: "/", UsedPct: 50, UsedGB: 10, TotalGB: 20, InodesUsed: 100, InodesFree: 300, InodesUsedPct: 25}))
+	must(m.SavePressure(types.PressurePoint{At: at, Resource: "cpu", SomeAvg10: 1.5, SomeTotal: 2500000}))
+	must(m.SaveSensor(types.SensorPoint{At: at, Kind: "temp", Chip: "coretemp", Label: "Package id 0", Value: 48, Crit: 100}))
+	must(m.SaveSensor(types.SensorPoint{At: at, Kind: "fan", Chip: "nct6775", Label: "fan1", Value: 1200}))
+
+	// The slow job runs hourly, so its 40-minute-old sample is current; the
+	// fast job's is stale. A series under the reserved prefix is not
+	// exported even if it reached the store.
+	must(m.SaveSample(types.Sample{At: at, Name: "queue_depth", Labels: types.Labels{"job": "fast", "queue": "mail"}, Value: 7}))
+	must(m.SaveSample(types.Sample{At: last.Add(-40 * time.Minute), Name: "backup_age_seconds", Labels: types.Labels{"job": "slow"}, Value: 3600}))
+	must(m.SaveSample(types.Sample{At: last.Add(-40 * time.Minute), Name: "queue_depth", Labels: types.Labels{"job": "fast", "queue": "sms"}, Value: 1}))
+	must(m.SaveSample(types.Sample{At: at, Name: "sysdash_cpu_usage_ratio", Labels: types.Labels{"job": "fast"}, Value: 1}))
+	m.SetLastCollector(last)
+
+	reg := collect.NewRegistry()
+	nop := func(context.Context, collect.Saver, time.Time) error { return nil }
+	reg.Register(collect.Func("exec:fast", nop), collect.Config{Enabled: true, Interval: time.Minute})
+	reg.Register(collect.Func("exec:slow", nop), collect.Config{Enabled: true, Interval: time.Hour})
+
+	a := &App{Store: m, Collectors: reg}
+	rec := httptest.NewRecorder()
+	a.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	got := strings.ReplaceAll(rec.Body.String(), strconv.FormatFloat(unixSeconds(last), 'g', -1, 64), "LAST_RUN")
+
+	golden := filepath.Join("testdata", "metrics.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("/metrics differs from %s (rerun with -update to accept):\n%s", golden, got)
+	}
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/query"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// rangeQueryPoints is roughly how many steps a range query without a step
+// parameter evaluates.
+const rangeQueryPoints = 250
+
+func (a *App) queryEngine() *query.Engine {
+	return &query.Engine{Store: a.Store, Limits: a.QueryLimits}
+}
+
+// queryError answers 422 for a query over its limits and 400 otherwise.
+func queryError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, query.ErrLimit) {
+		status = http.StatusUnprocessableEntity
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// getQuery evaluates the query parameter at time, which defaults to now.
+func (a *App) getQuery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	expr := strings.TrimSpace(q.Get("query"))
+	if expr == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	at := time.Now().UTC()
+	if s := q.Get("time"); s != "" {
+		t, err := parseTime(s)
+		if err != nil {
+			http.Error(w, "invalid time: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+	res, err := a.queryEngine().Instant(expr, at)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	out := struct {
+		Query  string         `json:"query"`
+		At     time.Time      `json:"t"`
+		Result []types.Sample `json:"result"`
+	}{Query: expr, At: at, Result: res}
+	if out.Result == nil {
+		out.Result = []types.Sample{}
+	}
+	writeJSON(w, out)
+}
+
+// getQueryRange evaluates the query parameter at every step of the window.
+// step defaults to the window split into about rangeQueryPoints steps.
+func (a *App) getQueryRange(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	expr := strings.TrimSpace(q.Get("query"))
+	if expr == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseWindow(r, "1h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step := max(to.Sub(from)/rangeQueryPoints, time.Second).Truncate(time.Second)
+	if s := q.Get("step"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid step: want a positive duration such as 15s or 1m", http.StatusBadRequest)
+			return
+		}
+		step = d
+	}
+	res, err := a.queryEngine().Range(expr, from, to, step)
+	if err != nil {
+		queryError(w, err)
+		return
+	}
+	out := struct {
+		Query  string         `json:"query"`
+		Range  string         `json:"range"`
+		From   time.Time      `json:"from"`
+		To     time.Time      `json:"to"`
+		Step   string         `json:"step"`
+		Series []types.Series `json:"series"`
+	}{Query: expr, Range: q.Get("range"), From: from, To: to, Step: step.String(), Series: res}
+	writeJSON(w, out)
+}
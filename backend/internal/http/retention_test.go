@@ -0,0 +1,53 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+)
+
+func TestPutRetention(t *testing.T) {
+	a := &App{Store: store.NewMemory()}
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		a.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/admin/retention", strings.NewReader(body)))
+		return rec
+	}
+
+	for name, body := range map[string]string{
+		"short tiers": `[{"family":"disk","ringCap":100,"tiers":[{"tier":"raw","retentionSeconds":3600}]}]`,
+		"wrong tier":  `[{"family":"disk","ringCap":100,"tiers":[{"tier":"1h","retentionSeconds":3600},{"retentionSeconds":7200},{"retentionSeconds":86400}]}]`,
+		"no ring cap": `[{"family":"logs","tiers":[{"retentionSeconds":3600}]}]`,
+		"unknown":     `[{"family":"gpu","ringCap":1,"tiers":[{"retentionSeconds":1}]}]`,
+		"not json":    `{`,
+	} {
+		if rec := put(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", name, rec.Code)
+		}
+	}
+
+	rec := put(`[{"family":"disk","ringCap":100,"tiers":[{"tier":"raw","retentionSeconds":3600},{"retentionSeconds":7200},{"retentionSeconds":86400}]}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got []retentionStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, rs := range got {
+		switch rs.Family {
+		case "disk":
+			if rs.RingCap != 100 || rs.Tiers[0].RetentionSeconds != 3600 || rs.Tiers[2].RetentionSeconds != 86400 {
+				t.Errorf("disk = %+v, want the new policy", rs)
+			}
+		case "cpu":
+			if rs.Tiers[0].RetentionSeconds != 30*24*3600 {
+				t.Errorf("cpu = %+v, want the default policy", rs)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,13 +17,24 @@ type Server struct {
 
 func NewServer(h http.Handler) *Server {
 	r := chi.NewRouter()
-	r.Use(chim.RequestID, chim.RealIP, chim.Logger, chim.Recoverer, timeout(30*time.Second))
+	r.Use(chim.RequestID, chim.RealIP, chim.Logger, chim.Recoverer, timeout(30*time.Second, "/api/stream"))
 	r.Mount("/", h)
 	return &Server{Router: r}
 }
 
-func timeout(d time.Duration) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler { return http.TimeoutHandler(next, d, "timeout") }
+// timeout bounds every request to d, except long-lived ones under the
+// exempt paths.
+func timeout(d time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		th := http.TimeoutHandler(next, d, "timeout")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(exempt, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			th.ServeHTTP(w, r)
+		})
+	}
 }
 
 func CORS(next http.Handler) http.Handler {
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+)
+
+const streamPing = 15 * time.Second
+
+// stream pushes store events as Server-Sent Events. ?topics= takes a comma
+// separated subset of store.Topics; all topics are sent by default. A client
+// that cannot keep up is dropped by the store and its stream ends.
+func (a *App) stream(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var topics []string
+	if q := strings.TrimSpace(r.URL.Query().Get("topics")); q != "" {
+		for _, t := range strings.Split(q, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(store.Topics, t) {
+				http.Error(w, "unknown topic "+t+": want one of "+strings.Join(store.Topics, ", "), http.StatusBadRequest)
+				return
+			}
+			topics = append(topics, t)
+		}
+	}
+
+	sub := a.Store.Subscribe(topics...)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fl.Flush()
+
+	ping := time.NewTicker(streamPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Topic, data); err != nil {
+				return
+			}
+			fl.Flush()
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			fl.Flush()
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// lookback is how far before the evaluation time a plain selector looks for
+// the latest sample of a series.
+const lookback = 5 * time.Minute
+
+const (
+	defaultMaxSeries  = 1000
+	defaultMaxSamples = 5_000_000
+	defaultMaxSteps   = 11000
+)
+
+// ErrLimit is returned, wrapped, when a query exceeds its Limits.
+var ErrLimit = errors.New("query limit exceeded")
+
+// Limits bound the work of one query. Zero fields take the defaults.
+type Limits struct {
+	// MaxSeries is how many series one selector may load.
+	MaxSeries int
+	// MaxSamples is how many samples the selectors of a query may load
+	// together, and how many points a range query may return.
+	MaxSamples int
+	// MaxSteps is how many steps a range query may evaluate.
+	MaxSteps int
+}
+
+// LimitsFromEnv reads QUERY_MAX_SERIES, QUERY_MAX_SAMPLES and
+// QUERY_MAX_STEPS.
+func LimitsFromEnv() Limits {
+	get := func(key string) int {
+		n, _ := strconv.Atoi(os.Getenv(key))
+		return max(n, 0)
+	}
+	return Limits{
+		MaxSeries:  get("QUERY_MAX_SERIES"),
+		MaxSamples: get("QUERY_MAX_SAMPLES"),
+		MaxSteps:   get("QUERY_MAX_STEPS"),
+	}
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxSeries == 0 {
+		l.MaxSeries = defaultMaxSeries
+	}
+	if l.MaxSamples == 0 {
+		l.MaxSamples = defaultMaxSamples
+	}
+	if l.MaxSteps == 0 {
+		l.MaxSteps = defaultMaxSteps
+	}
+	return l
+}
+
+// Selecter is the part of store.Store queries run against. Queries read
+// raw samples only: a rollup bucket can be longer than the range of a
+// function such as rate(x[1m]), which then sees too few points.
+type Selecter interface {
+	SelectPage(from, to time.Time, opts store.SelectOptions, ms ...types.Matcher) ([]types.Series, int, error)
+}
+
+// Engine evaluates queries against a store.
+type Engine struct {
+	Store  Selecter
+	Limits Limits
+}
+
+// Instant evaluates q at one point in time. Results are sorted by series,
+// except for a top-level topk, whose results are sorted by value, largest
+// first. Samples produced by a function or aggregation have no name.
+func (e *Engine) Instant(q string, at time.Time) ([]types.Sample, error) {
+	expr, err := Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := e.load(expr, at, at, e.Limits.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	vec, err := ev.eval(expr, at)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]types.Sample, len(vec))
+	for i, s := range vec {
+		out[i] = types.Sample{At: at, Name: s.name, Labels: s.labels, Value: s.v}
+	}
+	if a, ok := expr.(*Aggregate); ok && a.Op == "topk" {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Value > out[j].Value })
+	} else {
+		sort.Slice(out, func(i, j int) bool {
+			return types.SeriesID(out[i].Name, out[i].Labels) < types.SeriesID(out[j].Name, out[j].Labels)
+		})
+	}
+	return out, nil
+}
+
+// Range evaluates q at every step from from to to and returns one series
+// per label set seen, sorted by series.
+func (e *Engine) Range(q string, from, to time.Time, step time.Duration) ([]types.Series, error) {
+	lim := e.Limits.withDefaults()
+	if step <= 0 {
+		return nil, errors.New("step must be positive")
+	}
+	if steps := int64(to.Sub(from)/step) + 1; steps > int64(lim.MaxSteps) {
+		return nil, fmt.Errorf("%w: %d steps, the limit is %d; use a larger step", ErrLimit, steps, lim.MaxSteps)
+	}
+	expr, err := Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := e.load(expr, from, to, lim)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*types.Series{}
+	points := 0
+	for t := from; !t.After(to); t = t.Add(step) {
+		vec, err := ev.eval(expr, t)
+		if err != nil {
+			return nil, err
+		}
+		if points += len(vec); points > lim.MaxSamples {
+			return nil, fmt.Errorf("%w: the result exceeds %d points", ErrLimit, lim.MaxSamples)
+		}
+		for _, s := range vec {
+			id := types.SeriesID(s.name, s.labels)
+			series, ok := byID[id]
+			if !ok {
+				series = &types.Series{Name: s.name, Labels: s.labels}
+				byID[id] = series
+			}
+			series.Points = append(series.Points, types.SamplePoint{At: t, V: s.v})
+		}
+	}
+
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := make([]types.Series, len(ids))
+	for i, id := range ids {
+		out[i] = *byID[id]
+	}
+	return out, nil
+}
+
+// evaluator holds the series every selector of a query loaded for the
+// whole evaluation window.
+type evaluator struct {
+	data map[*Selector][]types.Series
+}
+
+// load fetches the series of every selector in expr, covering [from, to]
+// plus the range or lookback each selector reaches back.
+func (e *Engine) load(expr Expr, from, to time.Time, lim Limits) (*evaluator, error) {
+	ev := &evaluator{data: map[*Selector][]types.Series{}}
+	samples := 0
+	var walk func(Expr) error
+	walk = func(x Expr) error {
+		switch x := x.(type) {
+		case *Aggregate:
+			return walk(x.Expr)
+		case *Call:
+			return walk(x.Arg)
+		case *Selector:
+			back := lookback
+			if x.Range != 0 {
+				back = x.Range
+			}
+			// The store checks the limits while loading: the series
+			// count against its index, the samples against what the
+			// earlier selectors left of the budget. A budget used up
+			// exactly would read as no bound, so it is passed as one
+			// sample and the total check below rejects that sample.
+			series, _, err := e.Store.SelectPage(from.Add(-back), to, store.SelectOptions{
+				Raw:        true,
+				MaxSeries:  lim.MaxSeries,
+				MaxSamples: max(lim.MaxSamples-samples, 1),
+			}, x.Matchers...)
+			switch {
+			case errors.Is(err, store.ErrSeriesLimit):
+				return fmt.Errorf("%w: a selector matched more than %d series", ErrLimit, lim.MaxSeries)
+			case errors.Is(err, store.ErrSampleLimit):
+				return fmt.Errorf("%w: the selectors loaded more than %d samples", ErrLimit, lim.MaxSamples)
+			case err != nil:
+				return err
+			}
+			for _, s := range series {
+				samples += len(s.Points)
+			}
+			if samples > lim.MaxSamples {
+				return fmt.Errorf("%w: the selectors loaded more than %d samples", ErrLimit, lim.MaxSamples)
+			}
+			ev.data[x] = series
+		}
+		return nil
+	}
+	if err := walk(expr); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+type sample struct {
+	name   string
+	labels types.Labels
+	v      float64
+}
+
+type vector []sample
+
+func (ev *evaluator) eval(expr Expr, t time.Time) (vector, error) {
+	switch x := expr.(type) {
+	case *Selector:
+		var out vector
+		for _, s := range ev.data[x] {
+			if pts := window(s.Points, t, lookback); len(pts) > 0 {
+				out = append(out, sample{name: s.Name, labels: s.Labels, v: pts[len(pts)-1].V})
+			}
+		}
+		return out, nil
+	case *Call:
+		return ev.call(x, t)
+	case *Aggregate:
+		in, err := ev.eval(x.Expr, t)
+		if err != nil {
+			return nil, err
+		}
+		return aggregate(x, in), nil
+	}
+	return nil, fmt.Errorf("unknown expression %T", expr)
+}
+
+// window returns the points of pts in (t-d, t].
+func window(pts []types.SamplePoint, t time.Time, d time.Duration) []types.SamplePoint {
+	start := t.Add(-d)
+	i := sort.Search(len(pts), func(i int) bool { return pts[i].At.After(start) })
+	j := sort.Search(len(pts), func(j int) bool { return pts[j].At.After(t) })
+	return pts[i:j]
+}
+
+// call applies a range function to every series of its selector. The
+// results drop the metric name, so two series differing only by name would
+// collide; that is an error, as in Prometheus.
+func (ev *evaluator) call(c *Call, t time.Time) (vector, error) {
+	var out vector
+	seen := map[string]bool{}
+	for _, s := range ev.data[c.Arg] {
+		pts := window(s.Points, t, c.Arg.Range)
+		v, ok := overTime(c, pts)
+		if !ok {
+			continue
+		}
+		id := types.SeriesID("", s.Labels)
+		if seen[id] {
+			return nil, fmt.Errorf("%s: several series have the labels %s once their names are dropped", c.Func, id)
+		}
+		seen[id] = true
+		out = append(out, sample{labels: s.Labels, v: v})
+	}
+	return out, nil
+}
+
+func overTime(c *Call, pts []types.SamplePoint) (float64, bool) {
+	if len(pts) == 0 {
+		return 0, false
+	}
+	switch c.Func {
+	case "rate":
+		return rate(pts)
+	case "avg_over_time":
+		var sum float64
+		for _, p := range pts {
+			sum += p.V
+		}
+		return sum / float64(len(pts)), true
+	case "max_over_time":
+		m := math.Inf(-1)
+		for _, p := range pts {
+			m = math.Max(m, p.V)
+		}
+		return m, true
+	case "quantile_over_time":
+		vals := make([]float64, len(pts))
+		for i, p := range pts {
+			vals[i] = p.V
+		}
+		return quantile(c.Param, vals), true
+	}
+	return 0, false
+}
+
+// rate is the per-second increase of a counter between the first and last
+// sample of the window. A decrease is taken as a counter reset. Unlike
+// Prometheus, the increase is not extrapolated to the window edges.
+func rate(pts []types.SamplePoint) (float64, bool) {
+	if len(pts) < 2 {
+		return 0, false
+	}
+	var inc float64
+	for i := 1; i < len(pts); i++ {
+		d := pts[i].V - pts[i-1].V
+		if d < 0 {
+			d = pts[i].V
+		}
+		inc += d
+	}
+	secs := pts[len(pts)-1].At.Sub(pts[0].At).Seconds()
+	if secs <= 0 {
+		return 0, false
+	}
+	return inc / secs, true
+}
+
+// quantile interpolates linearly between the closest ranks, as Prometheus
+// does.
+func quantile(q float64, vals []float64) float64 {
+	sort.Float64s(vals)
+	rank := q * float64(len(vals)-1)
+	lo := math.Floor(rank)
+	hi := math.Min(lo+1, float64(len(vals)-1))
+	w := rank - lo
+	return vals[int(lo)]*(1-w) + vals[int(hi)]*w
+}
+
+// aggregate folds in into one sample per group of equal By labels. topk
+// instead keeps the k largest samples of each group unchanged.
+func aggregate(a *Aggregate, in vector) vector {
+	groups := map[string][]sample{}
+	var order []string
+	for _, s := range in {
+		key := types.SeriesID("", groupLabels(a.By, s.labels))
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+
+	var out vector
+	for _, key := range order {
+		g := groups[key]
+		if a.Op == "topk" {
+			sort.SliceStable(g, func(i, j int) bool { return g[i].v > g[j].v })
+			out = append(out, g[:min(int(a.Param), len(g))]...)
+			continue
+		}
+		var v float64
+		switch a.Op {
+		case "sum", "avg":
+			for _, s := range g {
+				v += s.v
+			}
+			if a.Op == "avg" {
+				v /= float64(len(g))
+			}
+		case "min":
+			v = math.Inf(1)
+			for _, s := range g {
+				v = math.Min(v, s.v)
+			}
+		case "max":
+			v = math.Inf(-1)
+			for _, s := range g {
+				v = math.Max(v, s.v)
+			}
+		case "count":
+			v = float64(len(g))
+		}
+		out = append(out, sample{labels: groupLabels(a.By, g[0].labels), v: v})
+	}
+	return out
+}
+
+func groupLabels(by []string, l types.Labels) types.Labels {
+	out := types.Labels{}
+	for _, k := range by {
+		if v, ok := l[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
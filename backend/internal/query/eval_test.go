@@ -0,0 +1,155 @@
+package query
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// TestRangeOverLongWindow runs short-range functions over a window long
+// enough that the store would answer a plain Select from 5m rollups.
+func TestRangeOverLongWindow(t *testing.T) {
+	m := store.NewMemory()
+	now := time.Now().UTC().Truncate(time.Minute)
+	start := now.Add(-5 * 24 * time.Hour)
+	for at, i := start, 0; !at.After(now); at, i = at.Add(15*time.Second), i+1 {
+		// A counter going up by one a second and a gauge alternating
+		// between 0 and 10.
+		if err := m.SaveSample(types.Sample{At: at, Name: "jobs_total", Labels: types.Labels{"job": "q"}, Value: float64(15 * i)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SaveSample(types.Sample{At: at, Name: "queue_depth", Labels: types.Labels{"job": "q"}, Value: float64(10 * (i % 2))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &Engine{Store: m}
+	from := now.Add(-4 * 24 * time.Hour)
+	for _, tc := range []struct {
+		q    string
+		want float64
+	}{
+		{"rate(jobs_total[5m])", 1},
+		{"max_over_time(queue_depth[1m])", 10},
+		{"avg_over_time(queue_depth[1m])", 5},
+	} {
+		res, err := e.Range(tc.q, from, now, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.q, err)
+		}
+		if len(res) != 1 || len(res[0].Points) != 4*24+1 {
+			t.Fatalf("%s: %d series, want one with a point every hour", tc.q, len(res))
+		}
+		for _, p := range res[0].Points {
+			if math.Abs(p.V-tc.want) > 1e-9 {
+				t.Fatalf("%s at %v = %v, want %v", tc.q, p.At, p.V, tc.want)
+			}
+		}
+	}
+}
+
+func TestInstantLimits(t *testing.T) {
+	m := store.NewMemory()
+	now := time.Now().UTC()
+	for i := range 3 {
+		if err := m.SaveSample(types.Sample{At: now, Name: "up", Labels: types.Labels{"job": "q", "i": string(rune('a' + i))}, Value: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := &Engine{Store: m, Limits: Limits{MaxSeries: 2}}
+	if _, err := e.Instant("up", now); err == nil {
+		t.Error("Instant loaded 3 series with MaxSeries 2")
+	}
+	e.Limits.MaxSeries = 3
+	if res, err := e.Instant("up", now); err != nil || len(res) != 3 {
+		t.Errorf("Instant = %v, %v; want 3 samples", res, err)
+	}
+}
+
+func TestSampleLimit(t *testing.T) {
+	m := store.NewMemory()
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := range 10 {
+		if err := m.SaveSample(types.Sample{At: now.Add(time.Duration(i-9) * time.Second), Name: "up", Value: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := &Engine{Store: m, Limits: Limits{MaxSamples: 9}}
+	if _, err := e.Instant("max_over_time(up[1m])", now); !errors.Is(err, ErrLimit) {
+		t.Errorf("Instant over 10 samples with MaxSamples 9: err = %v, want ErrLimit", err)
+	}
+	if _, err := e.Instant("max_over_time(up[5s])", now); err != nil {
+		t.Errorf("Instant over 6 samples with MaxSamples 9: %v", err)
+	}
+	e.Limits.MaxSamples = 10
+	if res, err := e.Instant("max_over_time(up[1m])", now); err != nil || len(res) != 1 {
+		t.Errorf("Instant = %v, %v; want one sample", res, err)
+	}
+}
+
+func TestInstant(t *testing.T) {
+	m := store.NewMemory()
+	now := time.Now().UTC().Truncate(time.Second)
+	save := func(name string, labels types.Labels, vals ...float64) {
+		for i, v := range vals {
+			at := now.Add(time.Duration(i-len(vals)+1) * 10 * time.Second)
+			if err := m.SaveSample(types.Sample{At: at, Name: name, Labels: labels, Value: v}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	save("temp", types.Labels{"host": "a", "zone": "1"}, 40, 50, 60, 70, 80)
+	save("temp", types.Labels{"host": "a", "zone": "2"}, 30)
+	save("temp", types.Labels{"host": "b", "zone": "1"}, 90)
+	// Reset after 30: the increase is 10 + 20 + 5 over 30 seconds.
+	save("jobs_total", types.Labels{"host": "a"}, 0, 10, 30, 5)
+
+	e := &Engine{Store: m}
+	for _, tc := range []struct {
+		q    string
+		want []types.Sample
+	}{
+		{`temp{zone!="1"}`, []types.Sample{{Name: "temp", Labels: types.Labels{"host": "a", "zone": "2"}, Value: 30}}},
+		{`count(temp{host!~"b"})`, []types.Sample{{Labels: types.Labels{}, Value: 2}}},
+		{"sum by (host) (temp)", []types.Sample{
+			{Labels: types.Labels{"host": "a"}, Value: 110},
+			{Labels: types.Labels{"host": "b"}, Value: 90},
+		}},
+		{"min(temp) by (zone)", []types.Sample{
+			{Labels: types.Labels{"zone": "1"}, Value: 80},
+			{Labels: types.Labels{"zone": "2"}, Value: 30},
+		}},
+		{"topk(2, temp)", []types.Sample{
+			{Name: "temp", Labels: types.Labels{"host": "b", "zone": "1"}, Value: 90},
+			{Name: "temp", Labels: types.Labels{"host": "a", "zone": "1"}, Value: 80},
+		}},
+		{`quantile_over_time(0.25, temp{host="a",zone="1"}[1m])`, []types.Sample{{Labels: types.Labels{"host": "a", "zone": "1"}, Value: 50}}},
+		{`quantile_over_time(0.9, temp{host="a",zone="1"}[1m])`, []types.Sample{{Labels: types.Labels{"host": "a", "zone": "1"}, Value: 76}}},
+		{"rate(jobs_total[1m])", []types.Sample{{Labels: types.Labels{"host": "a"}, Value: 35.0 / 30}}},
+		// A single sample has no rate.
+		{`rate(temp{zone="2"}[1m])`, []types.Sample{}},
+	} {
+		res, err := e.Instant(tc.q, now)
+		if err != nil {
+			t.Errorf("%s: %v", tc.q, err)
+			continue
+		}
+		for i := range tc.want {
+			tc.want[i].At = now
+		}
+		if len(res) != len(tc.want) || (len(res) > 0 && !reflect.DeepEqual(res, tc.want)) {
+			t.Errorf("%s =\n%+v\nwant\n%+v", tc.q, res, tc.want)
+		}
+	}
+
+	// Dropping the name of temp and jobs_total would merge their series.
+	save("load", types.Labels{"host": "a"}, 1, 2)
+	if _, err := e.Instant(`max_over_time({host="a"}[1m])`, now); err == nil {
+		t.Error("max_over_time merged series that differ only by name")
+	}
+}
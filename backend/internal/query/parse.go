@@ -0,0 +1,405 @@
+// Package query evaluates a small subset of PromQL against the store:
+//
+//	cpu_time_percent{state=~"user|system"}
+//	rate(pressure_some_stall_microseconds_total{resource="io"}[5m])
+//	quantile_over_time(0.95, sensor_value{kind="temp"}[1h])
+//	topk(3, avg by (path) (avg_over_time(cgroup_cpu_percent[10m])))
+//
+// Selectors take =, !=, =~ and !~ matchers. The range functions are rate,
+// avg_over_time, max_over_time and quantile_over_time; the aggregations are
+// sum, avg, min, max and count, optionally by a list of labels, and topk.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// Expr is a parsed query.
+type Expr interface{ expr() }
+
+// Selector selects series by their name and labels. Range is non-zero for
+// a range selector, which is only valid as the argument of a function.
+type Selector struct {
+	Matchers []types.Matcher
+	Range    time.Duration
+}
+
+// Call applies a range function to a range selector. Param is the quantile
+// of quantile_over_time.
+type Call struct {
+	Func  string
+	Param float64
+	Arg   *Selector
+}
+
+// Aggregate folds series into one per distinct value of the By labels.
+// Param is the k of topk.
+type Aggregate struct {
+	Op    string
+	By    []string
+	Param float64
+	Expr  Expr
+}
+
+func (*Selector) expr()  {}
+func (*Call) expr()      {}
+func (*Aggregate) expr() {}
+
+var (
+	functions    = map[string]bool{"rate": true, "avg_over_time": true, "max_over_time": true, "quantile_over_time": true}
+	aggregations = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true, "topk": true}
+)
+
+// Parse parses a query.
+func Parse(q string) (Expr, error) {
+	p := &parser{in: q}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.in) {
+		return nil, p.errorf("unexpected %q", p.in[p.pos:])
+	}
+	if s, ok := e.(*Selector); ok && s.Range != 0 {
+		return nil, fmt.Errorf("a range selector must be the argument of a function such as rate")
+	}
+	return e, nil
+}
+
+type parser struct {
+	in  string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("parse error at char %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.in) && unicode.IsSpace(rune(p.in[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.in) {
+		return 0
+	}
+	return p.in[p.pos]
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.in) {
+			return p.errorf("expected %q, got end of query", c)
+		}
+		return p.errorf("expected %q, got %q", c, p.in[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+func isIdentByte(c byte, first bool) bool {
+	return c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
+
+func (p *parser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.in) && isIdentByte(p.in[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.in[start:p.pos]
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	if p.peek() == '{' {
+		return p.parseSelector("")
+	}
+	name := p.ident()
+	if name == "" {
+		if p.pos >= len(p.in) {
+			return nil, p.errorf("unexpected end of query")
+		}
+		return nil, p.errorf("unexpected %q", p.in[p.pos])
+	}
+	switch {
+	case aggregations[name]:
+		return p.parseAggregate(name)
+	case functions[name]:
+		return p.parseCall(name)
+	}
+	return p.parseSelector(name)
+}
+
+func (p *parser) parseSelector(name string) (*Selector, error) {
+	s := &Selector{}
+	if name != "" {
+		s.Matchers = append(s.Matchers, types.Matcher{Name: types.NameLabel, Value: name})
+	}
+	if p.peek() == '{' {
+		p.pos++
+		for p.peek() != '}' {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			s.Matchers = append(s.Matchers, m)
+			if p.peek() == ',' {
+				p.pos++
+				continue
+			}
+			if p.peek() != '}' {
+				return nil, p.expect('}')
+			}
+		}
+		p.pos++
+	}
+	if len(s.Matchers) == 0 {
+		return nil, p.errorf("a selector needs a metric name or at least one matcher")
+	}
+	if p.peek() == '[' {
+		p.pos++
+		p.skipSpace()
+		end := strings.IndexByte(p.in[p.pos:], ']')
+		if end < 0 {
+			return nil, p.errorf("unterminated range")
+		}
+		d, err := parseDuration(strings.TrimSpace(p.in[p.pos : p.pos+end]))
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		s.Range = d
+		p.pos += end + 1
+	}
+	return s, nil
+}
+
+func (p *parser) parseMatcher() (types.Matcher, error) {
+	label := p.ident()
+	if label == "" {
+		return types.Matcher{}, p.errorf("expected a label name")
+	}
+	p.skipSpace()
+	op, typ := "", types.MatchEqual
+	for _, o := range []struct {
+		op  string
+		typ types.MatchType
+	}{{"=~", types.MatchRegexp}, {"!=", types.MatchNotEqual}, {"!~", types.MatchNotRegexp}, {"=", types.MatchEqual}} {
+		if strings.HasPrefix(p.in[p.pos:], o.op) {
+			op, typ = o.op, o.typ
+			break
+		}
+	}
+	if op == "" {
+		return types.Matcher{}, p.errorf("expected =, !=, =~ or !~ after %s", label)
+	}
+	p.pos += len(op)
+	value, err := p.parseString()
+	if err != nil {
+		return types.Matcher{}, err
+	}
+	m, err := types.NewMatcher(typ, label, value)
+	if err != nil {
+		return types.Matcher{}, p.errorf("label %s: %v", label, err)
+	}
+	return m, nil
+}
+
+// parseString reads a double- or single-quoted string with Go escapes.
+func (p *parser) parseString() (string, error) {
+	q := p.peek()
+	if q != '"' && q != '\'' {
+		return "", p.errorf("expected a quoted string")
+	}
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.in) && p.in[p.pos] != q {
+		if p.in[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.in) {
+		return "", p.errorf("unterminated string")
+	}
+	p.pos++
+	lit := p.in[start:p.pos]
+	if q == '\'' {
+		lit = `"` + strings.ReplaceAll(lit[1:len(lit)-1], `"`, `\"`) + `"`
+	}
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		return "", p.errorf("bad string %s", p.in[start:p.pos])
+	}
+	return s, nil
+}
+
+func (p *parser) parseNumber() (float64, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.in) && strings.IndexByte("0123456789.eE+-", p.in[p.pos]) >= 0 {
+		p.pos++
+	}
+	v, err := strconv.ParseFloat(p.in[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return 0, p.errorf("expected a number")
+	}
+	return v, nil
+}
+
+func (p *parser) parseCall(name string) (Expr, error) {
+	c := &Call{Func: name}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	if name == "quantile_over_time" {
+		q, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if q < 0 || q > 1 {
+			return nil, p.errorf("quantile must be between 0 and 1, got %g", q)
+		}
+		c.Param = q
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := arg.(*Selector)
+	if !ok || sel.Range == 0 {
+		return nil, p.errorf("%s needs a range selector such as metric[5m]", name)
+	}
+	c.Arg = sel
+	return c, p.expect(')')
+}
+
+func (p *parser) parseAggregate(op string) (Expr, error) {
+	a := &Aggregate{Op: op}
+	var err error
+	if p.isKeyword("by") {
+		if a.By, err = p.parseLabelList(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	if op == "topk" {
+		k, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		if k < 1 || k != float64(int(k)) {
+			return nil, p.errorf("topk needs a positive integer, got %g", k)
+		}
+		a.Param = k
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+	if a.Expr, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if s, ok := a.Expr.(*Selector); ok && s.Range != 0 {
+		return nil, p.errorf("%s cannot aggregate a range selector; use a function such as avg_over_time", op)
+	}
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	if a.By == nil && p.isKeyword("by") {
+		if a.By, err = p.parseLabelList(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// isKeyword consumes kw if it is the next word.
+func (p *parser) isKeyword(kw string) bool {
+	save := p.pos
+	if p.ident() == kw {
+		return true
+	}
+	p.pos = save
+	return false
+}
+
+func (p *parser) parseLabelList() ([]string, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	labels := []string{}
+	for p.peek() != ')' {
+		l := p.ident()
+		if l == "" {
+			return nil, p.errorf("expected a label name")
+		}
+		labels = append(labels, l)
+		if p.peek() == ',' {
+			p.pos++
+		} else if p.peek() != ')' {
+			return nil, p.expect(')')
+		}
+	}
+	p.pos++
+	return labels, nil
+}
+
+// parseDuration accepts Go durations plus the d and w units of Prometheus,
+// e.g. 90s, 1h30m, 7d.
+func parseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		j := i
+		for j < len(rest) && (rest[j] < '0' || rest[j] > '9') {
+			j++
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if i == 0 || err != nil {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		var unit time.Duration
+		switch rest[i:j] {
+		case "ms":
+			unit = time.Millisecond
+		case "s":
+			unit = time.Second
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		case "d":
+			unit = 24 * time.Hour
+		case "w":
+			unit = 7 * 24 * time.Hour
+		default:
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		total += time.Duration(n) * unit
+		rest = rest[j:]
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	return total, nil
+}
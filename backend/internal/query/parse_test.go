@@ -0,0 +1,150 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// show renders e compactly so tests can compare parse trees without
+// reaching into the compiled regexps of matchers.
+func show(e Expr) string {
+	switch e := e.(type) {
+	case *Selector:
+		ops := map[types.MatchType]string{types.MatchEqual: "=", types.MatchNotEqual: "!=", types.MatchRegexp: "=~", types.MatchNotRegexp: "!~"}
+		var ms []string
+		for _, m := range e.Matchers {
+			ms = append(ms, fmt.Sprintf("%s%s%q", m.Name, ops[m.Type], m.Value))
+		}
+		s := "{" + strings.Join(ms, ",") + "}"
+		if e.Range != 0 {
+			s += "[" + e.Range.String() + "]"
+		}
+		return s
+	case *Call:
+		return fmt.Sprintf("%s(%g,%s)", e.Func, e.Param, show(e.Arg))
+	case *Aggregate:
+		return fmt.Sprintf("%s by %v (%g,%s)", e.Op, e.By, e.Param, show(e.Expr))
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"up", `{__name__="up"}`},
+		{`up{job="a"}`, `{__name__="up",job="a"}`},
+		{`up{job!="a"}`, `{__name__="up",job!="a"}`},
+		{`up{job=~"a|b"}`, `{__name__="up",job=~"a|b"}`},
+		{`up{job!~'a.*', host = "x",}`, `{__name__="up",job!~"a.*",host="x"}`},
+		{`{__name__=~"cpu_.*"}`, `{__name__=~"cpu_.*"}`},
+		{`up{path="C:\\tmp\"x\""}`, `{__name__="up",path="C:\\tmp\"x\""}`},
+		{"rate(up[5m])", `rate(0,{__name__="up"}[5m0s])`},
+		{"max_over_time(up[ 1h30m ])", `max_over_time(0,{__name__="up"}[1h30m0s])`},
+		{"avg_over_time(up[2d])", `avg_over_time(0,{__name__="up"}[48h0m0s])`},
+		{"avg_over_time(up[1w])", `avg_over_time(0,{__name__="up"}[168h0m0s])`},
+		{"avg_over_time(up[500ms])", `avg_over_time(0,{__name__="up"}[500ms])`},
+		{"quantile_over_time(0.95, up[1h])", `quantile_over_time(0.95,{__name__="up"}[1h0m0s])`},
+		{"sum(up)", `sum by [] (0,{__name__="up"})`},
+		{"avg by (host, job) (up)", `avg by [host job] (0,{__name__="up"})`},
+		{"avg (up) by (host)", `avg by [host] (0,{__name__="up"})`},
+		{"topk(3, up)", `topk by [] (3,{__name__="up"})`},
+		{"topk by (host) (2, rate(up[1m]))", `topk by [host] (2,rate(0,{__name__="up"}[1m0s]))`},
+		{"topk(3, avg by (path) (avg_over_time(cgroup_cpu_percent[10m])))", `topk by [] (3,avg by [path] (0,avg_over_time(0,{__name__="cgroup_cpu_percent"}[10m0s])))`},
+	} {
+		e, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.in, err)
+			continue
+		}
+		if got := show(e); got != tc.want {
+			t.Errorf("Parse(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseMatchers(t *testing.T) {
+	e, err := Parse(`up{a="x", b!="x", c=~"x|y", d!~"x|y"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := e.(*Selector).Matchers
+	for _, tc := range []struct {
+		labels types.Labels
+		want   bool
+	}{
+		{types.Labels{"a": "x", "b": "y", "c": "y", "d": "z"}, true},
+		{types.Labels{"a": "x", "c": "x"}, true},
+		{types.Labels{"a": "y", "c": "x"}, false},
+		{types.Labels{"a": "x", "b": "x", "c": "x"}, false},
+		{types.Labels{"a": "x", "c": "xy"}, false},
+		{types.Labels{"a": "x", "c": "x", "d": "y"}, false},
+	} {
+		got := true
+		for _, m := range ms {
+			got = got && m.Matches("up", tc.labels)
+		}
+		if got != tc.want {
+			t.Errorf("labels %v: match = %v, want %v", tc.labels, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"", "parse error at char 1: unexpected end of query"},
+		{"(up)", `parse error at char 1: unexpected '('`},
+		{"up up", `parse error at char 4: unexpected "up"`},
+		{"{}", "parse error at char 3: a selector needs a metric name or at least one matcher"},
+		{`up{job}`, "parse error at char 7: expected =, !=, =~ or !~ after job"},
+		{`up{job=a}`, "parse error at char 8: expected a quoted string"},
+		{`up{job="a}`, "parse error at char 11: unterminated string"},
+		{`up{job="a" host="b"}`, `parse error at char 12: expected '}', got 'h'`},
+		{`up{="a"}`, "parse error at char 4: expected a label name"},
+		{`up{job=~"("}`, "parse error at char 12: label job: error parsing regexp"},
+		{"up[5m]", "a range selector must be the argument of a function such as rate"},
+		{"rate(up[5m)", "parse error at char 9: unterminated range"},
+		{"rate(up[5x])", `parse error at char 9: bad duration "5x"`},
+		{"rate(up)", "parse error at char 8: rate needs a range selector such as metric[5m]"},
+		{"rate(up[5m]", "parse error at char 12: expected ')', got end of query"},
+		{"quantile_over_time(up[5m])", "parse error at char 20: expected a number"},
+		{"quantile_over_time(1.5, up[5m])", "parse error at char 23: quantile must be between 0 and 1, got 1.5"},
+		{"quantile_over_time(0.5 up[5m])", "parse error at char 24: expected ',', got 'u'"},
+		{"topk(up)", "parse error at char 6: expected a number"},
+		{"topk(0, up)", "parse error at char 7: topk needs a positive integer, got 0"},
+		{"topk(1.5, up)", "parse error at char 9: topk needs a positive integer, got 1.5"},
+		{"sum(up[5m])", "parse error at char 11: sum cannot aggregate a range selector; use a function such as avg_over_time"},
+		{"sum by host (up)", `parse error at char 8: expected '(', got 'h'`},
+		{"sum by (host) (up) by (job)", `parse error at char 20: unexpected "by (job)"`},
+	} {
+		_, err := Parse(tc.in)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("Parse(%q): err = %v, want %q", tc.in, err, tc.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"90s":   90 * time.Second,
+		"1h30m": 90 * time.Minute,
+		"1d12h": 36 * time.Hour,
+		"250ms": 250 * time.Millisecond,
+	} {
+		got, err := parseDuration(in)
+		if err != nil || got != want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "5", "m", "5y", "-5m", "0s"} {
+		if d, err := parseDuration(in); err == nil {
+			t.Errorf("parseDuration(%q) = %v, want an error", in, d)
+		}
+	}
+}
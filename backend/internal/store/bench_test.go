@@ -0,0 +1,189 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// benchRing is the number of samples each benchmark series holds.
+const benchRing = 50_000
+
+var benchStart = time.Now().Add(-benchRing * time.Second)
+
+// benchRetention lets an exec series keep benchRing samples.
+func benchRetention() store.Retention {
+	r := store.DefaultRetention()
+	p := r["exec"]
+	p.RingCap = benchRing
+	r["exec"] = p
+	return r
+}
+
+func benchSample(i int) types.Sample {
+	return types.Sample{
+		At:     benchStart.Add(time.Duration(i) * time.Second),
+		Name:   "queue_depth",
+		Labels: types.Labels{"job": "bench"},
+		Value:  float64(i % 100),
+	}
+}
+
+// fill writes a full ring and returns the index of the next sample.
+func fill(b *testing.B, s store.Store) int {
+	b.Helper()
+	for i := range benchRing {
+		if err := s.SaveSample(benchSample(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return benchRing
+}
+
+// openFilled opens a store whose log holds full rings of the given number
+// of series. The log is written directly, which skips the fsync of every
+// record that filling it through the store would cost.
+func openFilled(b *testing.B, series int) *store.Memory {
+	b.Helper()
+	dir := b.TempDir()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	seq := 0
+	for i := range benchRing {
+		s := benchSample(i)
+		for j := range series {
+			s.Labels = types.Labels{"job": "bench", "queue": strconv.Itoa(j)}
+			seq++
+			rec := struct {
+				Seq  int          `json:"seq"`
+				Kind string       `json:"k"`
+				Data types.Sample `json:"d"`
+			}{seq, "sample", s}
+			if err := enc.Encode(rec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wal.log"), buf.Bytes(), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	m, err := store.Open(dir, benchRetention())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { m.Close() })
+	return m
+}
+
+func newBenchMemory(b *testing.B) *store.Memory {
+	m := store.NewMemory()
+	if err := m.SetRetention(benchRetention()); err != nil {
+		b.Fatal(err)
+	}
+	return m
+}
+
+func BenchmarkSaveSampleFullRing(b *testing.B) {
+	m := newBenchMemory(b)
+	next := fill(b, m)
+	b.ResetTimer()
+	for i := range b.N {
+		if err := m.SaveSample(benchSample(next + i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSelectFullRing(b *testing.B) {
+	m := newBenchMemory(b)
+	fill(b, m)
+	from, to := benchStart, benchStart.Add(benchRing*time.Second)
+	b.ResetTimer()
+	for range b.N {
+		if got := m.Select(from, to); len(got) != 1 {
+			b.Fatalf("%d series", len(got))
+		}
+	}
+}
+
+// BenchmarkSelectDuringWrites reads the last hour of the ring from every
+// CPU while one writer keeps appending.
+func BenchmarkSelectDuringWrites(b *testing.B) {
+	m := newBenchMemory(b)
+	next := fill(b, m)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := next; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = m.SaveSample(benchSample(i))
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			to := time.Now()
+			m.Select(to.Add(-time.Hour), to)
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+}
+
+// BenchmarkSelectDuringSnapshots reads the last hour of the ring from every
+// CPU while snapshots of a store with ten full rings are taken back to back.
+func BenchmarkSelectDuringSnapshots(b *testing.B) {
+	m := openFilled(b, 10)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := m.Snapshot(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			to := time.Now()
+			m.Select(to.Add(-time.Hour), to, types.Matcher{Name: "queue", Value: "0"})
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	m := openFilled(b, 1)
+	b.ResetTimer()
+	for range b.N {
+		if err := m.Snapshot(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
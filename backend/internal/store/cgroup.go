@@ -0,0 +1,60 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type CgroupSeries struct {
+	Path   string              `json:"path"`
+	Points []types.CgroupPoint `json:"points"`
+}
+
+// cgroupFamily rolls the memory limit up as the bucket maximum, so that a
+// limit set mid-bucket is not averaged with "unlimited".
+var cgroupFamily = &family[types.CgroupPoint]{
+	at:     func(p types.CgroupPoint) time.Time { return p.At },
+	labels: func(p types.CgroupPoint) types.Labels { return types.Labels{"path": p.Path} },
+	point: func(at time.Time, l types.Labels) types.CgroupPoint {
+		return types.CgroupPoint{At: at, Path: l["path"]}
+	},
+	fields: []Field[types.CgroupPoint]{
+		floatField("cgroup_cpu_percent", nil, func(p *types.CgroupPoint) *float64 { return &p.CPUPct }),
+		uintField("cgroup_memory_current_bytes", nil, func(p *types.CgroupPoint) *uint64 { return &p.MemoryCurrent }),
+		uintField("cgroup_memory_max_bytes", nil, func(p *types.CgroupPoint) *uint64 { return &p.MemoryMax }).rolledUpAsMax(),
+		floatField("cgroup_io_read_bytes_per_second", nil, func(p *types.CgroupPoint) *float64 { return &p.IOReadBytes }),
+		floatField("cgroup_io_write_bytes_per_second", nil, func(p *types.CgroupPoint) *float64 { return &p.IOWriteBytes }),
+		floatField("cgroup_io_read_iops", nil, func(p *types.CgroupPoint) *float64 { return &p.IOReadIOPS }),
+		floatField("cgroup_io_write_iops", nil, func(p *types.CgroupPoint) *float64 { return &p.IOWriteIOPS }),
+		uintField("cgroup_pids", nil, func(p *types.CgroupPoint) *uint64 { return &p.Pids }),
+	},
+}
+
+func (m *Memory) SaveCgroup(p types.CgroupPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putCgroup(p)
+	if err := m.persist("cgroup", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicCgroup, p.At, p)
+	return nil
+}
+
+func (m *Memory) putCgroup(p types.CgroupPoint) { putPoint(m, cgroupFamily, p) }
+
+// CgroupBetween returns the series of every cgroup with samples in
+// [from, to], sorted by path so parents precede their children.
+func (m *Memory) CgroupBetween(from, to time.Time) []CgroupSeries {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	groups := pointsBetween(m, cgroupFamily, from, to)
+	res := make([]CgroupSeries, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, CgroupSeries{Path: g.labels["path"], Points: g.points})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Path < res[j].Path })
+	return res
+}
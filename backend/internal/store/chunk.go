@@ -0,0 +1,473 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// chunkSamples is how many samples a chunk holds before the series starts
+// a new one, the size Prometheus cuts its chunks at: compression gains
+// little past it, while every read decodes a chunk from its start.
+const chunkSamples = 120
+
+var errChunkCorrupt = errors.New("corrupt chunk")
+
+// chunk holds up to chunkSamples samples compressed as in Facebook's Gorilla
+// paper: timestamps as the delta of their deltas and values as the XOR with
+// the previous value. A sample of a steady metric takes a few bytes instead
+// of the 32 of a SamplePoint.
+//
+// The first sample is stored in full. Then every timestamp is written as
+// its delta-of-delta with a prefix giving its width. Timestamps are kept in
+// nanoseconds, as saved, so the widths are those of Gorilla scaled to the
+// jitter of a ticker rather than to whole milliseconds:
+//
+//	0                  the delta did not change
+//	10   + 20 bits     |dod| < 2^19 ns, about 0.5ms
+//	110  + 27 bits     |dod| < 2^26 ns, about 67ms
+//	1110 + 36 bits     |dod| < 2^35 ns, about 34s
+//	1111 + 64 bits     anything else
+//
+// and every value as the XOR with the previous value:
+//
+//	0                                        the value did not change
+//	10 + meaningful bits                     the XOR fits the previous window
+//	11 + 5 bits leading zeros + 6 bits length + meaningful bits
+type chunk struct {
+	b     []byte
+	nbits int
+	n     int
+	minT  int64
+	maxT  int64
+
+	// appender state: the last timestamp, delta and value, and the window
+	// of meaningful bits of the last XOR, 0xff leading bits for none yet.
+	t        int64
+	delta    int64
+	v        float64
+	leading  uint8
+	trailing uint8
+}
+
+func (c *chunk) full() bool { return c.n >= chunkSamples }
+
+func (c *chunk) writeBit(bit bool) {
+	if c.nbits%8 == 0 {
+		c.b = append(c.b, 0)
+	}
+	if bit {
+		c.b[len(c.b)-1] |= 1 << (7 - c.nbits%8)
+	}
+	c.nbits++
+}
+
+func (c *chunk) writeBits(u uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		c.writeBit(u>>i&1 == 1)
+	}
+}
+
+// append adds a sample; t must not be before the last one.
+func (c *chunk) append(t int64, v float64) {
+	switch c.n {
+	case 0:
+		c.writeBits(uint64(t), 64)
+		c.writeBits(math.Float64bits(v), 64)
+		c.minT, c.leading = t, 0xff
+	case 1:
+		c.delta = t - c.t
+		c.writeBits(uint64(c.delta), 64)
+		c.appendValue(v)
+	default:
+		delta := t - c.t
+		dod := delta - c.delta
+		switch {
+		case dod == 0:
+			c.writeBit(false)
+		case fitsBits(dod, 20):
+			c.writeBits(0b10, 2)
+			c.writeBits(uint64(dod), 20)
+		case fitsBits(dod, 27):
+			c.writeBits(0b110, 3)
+			c.writeBits(uint64(dod), 27)
+		case fitsBits(dod, 36):
+			c.writeBits(0b1110, 4)
+			c.writeBits(uint64(dod), 36)
+		default:
+			c.writeBits(0b1111, 4)
+			c.writeBits(uint64(dod), 64)
+		}
+		c.delta = delta
+		c.appendValue(v)
+	}
+	c.t, c.v, c.maxT = t, v, t
+	c.n++
+}
+
+// fitsBits reports whether x fits an n-bit two's complement integer.
+func fitsBits(x int64, n uint) bool {
+	return -(1<<(n-1)) <= x && x < 1<<(n-1)
+}
+
+func (c *chunk) appendValue(v float64) {
+	xor := math.Float64bits(v) ^ math.Float64bits(c.v)
+	if xor == 0 {
+		c.writeBit(false)
+		return
+	}
+	c.writeBit(true)
+	leading, trailing := uint8(bits.LeadingZeros64(xor)), uint8(bits.TrailingZeros64(xor))
+	// The leading count is written in 5 bits.
+	if leading > 31 {
+		leading = 31
+	}
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		c.writeBit(false)
+		c.writeBits(xor>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+	c.leading, c.trailing = leading, trailing
+	sig := 64 - int(leading) - int(trailing)
+	c.writeBit(true)
+	c.writeBits(uint64(leading), 5)
+	// A length of 64 does not fit 6 bits and is written as 0; it cannot
+	// otherwise be 0 since the XOR is not.
+	c.writeBits(uint64(sig), 6)
+	c.writeBits(xor>>trailing, sig)
+}
+
+// iter returns an iterator over the samples of c.
+func (c *chunk) iter() *chunkIter { return &chunkIter{b: c.b, n: c.n} }
+
+// chunkIter decodes a chunk sample by sample.
+type chunkIter struct {
+	b   []byte
+	pos int
+	n   int
+	i   int
+	err error
+
+	t        int64
+	delta    int64
+	v        float64
+	leading  uint8
+	trailing uint8
+}
+
+func (it *chunkIter) readBit() bool {
+	if it.pos >= 8*len(it.b) {
+		it.err = errChunkCorrupt
+		return false
+	}
+	bit := it.b[it.pos/8]>>(7-it.pos%8)&1 == 1
+	it.pos++
+	return bit
+}
+
+// readBits reads n bits, taking as many at a time as the current byte
+// holds.
+func (it *chunkIter) readBits(n int) uint64 {
+	if it.pos+n > 8*len(it.b) {
+		it.err = errChunkCorrupt
+		return 0
+	}
+	var u uint64
+	for n > 0 {
+		off := it.pos % 8
+		take := 8 - off
+		if take > n {
+			take = n
+		}
+		u = u<<take | uint64(it.b[it.pos/8]>>(8-off-take)&(1<<take-1))
+		it.pos += take
+		n -= take
+	}
+	return u
+}
+
+// readSigned reads an n-bit two's complement integer.
+func (it *chunkIter) readSigned(n int) int64 {
+	u := it.readBits(n)
+	return int64(u<<(64-n)) >> (64 - n)
+}
+
+// next advances to the next sample and reports whether there is one.
+func (it *chunkIter) next() bool {
+	if it.i >= it.n || it.err != nil {
+		return false
+	}
+	switch it.i {
+	case 0:
+		it.t = int64(it.readBits(64))
+		it.v = math.Float64frombits(it.readBits(64))
+	case 1:
+		it.delta = int64(it.readBits(64))
+		it.t += it.delta
+		it.readValue()
+	default:
+		var dod int64
+		switch {
+		case !it.readBit():
+		case !it.readBit():
+			dod = it.readSigned(20)
+		case !it.readBit():
+			dod = it.readSigned(27)
+		case !it.readBit():
+			dod = it.readSigned(36)
+		default:
+			dod = int64(it.readBits(64))
+		}
+		it.delta += dod
+		it.t += it.delta
+		it.readValue()
+	}
+	if it.err != nil {
+		return false
+	}
+	it.i++
+	return true
+}
+
+func (it *chunkIter) readValue() {
+	if !it.readBit() {
+		return
+	}
+	if it.readBit() {
+		it.leading = uint8(it.readBits(5))
+		sig := uint8(it.readBits(6))
+		if sig == 0 {
+			sig = 64
+		}
+		it.trailing = 64 - it.leading - sig
+	}
+	sig := 64 - int(it.leading) - int(it.trailing)
+	xor := it.readBits(sig) << it.trailing
+	it.v = math.Float64frombits(math.Float64bits(it.v) ^ xor)
+}
+
+// at returns the current sample.
+func (it *chunkIter) at() (int64, float64) { return it.t, it.v }
+
+// loadChunk rebuilds a chunk from its encoded samples, recovering the state
+// needed to keep appending to it.
+func loadChunk(b []byte, n int) (*chunk, error) {
+	c := &chunk{b: b, n: n}
+	it := c.iter()
+	for it.next() {
+		if it.i == 1 {
+			c.minT = it.t
+		}
+	}
+	if it.err != nil || it.i != n {
+		return nil, errChunkCorrupt
+	}
+	c.nbits = it.pos
+	c.t, c.delta, c.v, c.maxT = it.t, it.delta, it.v, it.t
+	c.leading, c.trailing = it.leading, it.trailing
+	if c.leading == 0 && c.trailing == 0 {
+		// Maybe no window yet; starting a new one is always valid.
+		c.leading = 0xff
+	}
+	return c, nil
+}
+
+// memSeries is one series as the store holds it: its raw samples in chunks
+// of chunkSamples, oldest first, the last one still taking appends, and
+// its rollup. The name, labels and family never change; mu guards the
+// rest.
+type memSeries struct {
+	name   string
+	labels types.Labels
+	// family is the retention family, see familyOf.
+	family string
+
+	mu     sync.RWMutex
+	chunks []*chunk
+	count  int
+	rollup *rollup
+}
+
+// append adds a sample at the end of s and trims s to ringCap samples. A
+// sample older than the newest one is dropped, as chunks cannot take it,
+// and append returns false; one at the same time as the newest is kept.
+func (s *memSeries) append(at time.Time, v float64, ringCap int) bool {
+	t := at.UnixNano()
+	if n := len(s.chunks); n > 0 && t < s.chunks[n-1].maxT {
+		return false
+	}
+	if n := len(s.chunks); n == 0 || s.chunks[n-1].full() {
+		s.chunks = append(s.chunks, &chunk{})
+	}
+	s.chunks[len(s.chunks)-1].append(t, v)
+	s.count++
+	s.trim(ringCap)
+	return true
+}
+
+// clone copies s for a snapshot. Full chunks are never written again and
+// are shared; the head chunk, which appends extend in place, is copied.
+func (s *memSeries) clone() *memSeries {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c := &memSeries{name: s.name, labels: s.labels, family: s.family, count: s.count, rollup: s.rollup.clone()}
+	c.chunks = slices.Clone(s.chunks)
+	if n := len(c.chunks); n > 0 && !c.chunks[n-1].full() {
+		head := *c.chunks[n-1]
+		head.b = slices.Clone(head.b)
+		c.chunks[n-1] = &head
+	}
+	return c
+}
+
+// trim drops the oldest chunks while at least ringCap samples remain, so a
+// series holds up to a chunk more than ringCap.
+func (s *memSeries) trim(ringCap int) {
+	for len(s.chunks) > 1 && s.count-s.chunks[0].n >= ringCap {
+		s.count -= s.chunks[0].n
+		s.chunks[0] = nil
+		s.chunks = s.chunks[1:]
+	}
+}
+
+// dropBefore drops the samples before cutoff. Whole chunks go at once; the
+// one straddling cutoff is encoded again without its older samples.
+func (s *memSeries) dropBefore(cutoff time.Time) {
+	t := cutoff.UnixNano()
+	i := sort.Search(len(s.chunks), func(i int) bool { return s.chunks[i].maxT >= t })
+	for _, c := range s.chunks[:i] {
+		s.count -= c.n
+	}
+	s.chunks = s.chunks[i:]
+	if len(s.chunks) == 0 || s.chunks[0].minT >= t {
+		return
+	}
+	old, kept := s.chunks[0], &chunk{}
+	for it := old.iter(); it.next(); {
+		if ts, v := it.at(); ts >= t {
+			kept.append(ts, v)
+		}
+	}
+	s.count += kept.n - old.n
+	s.chunks[0] = kept
+}
+
+// iter returns an iterator over the samples of s in [from, to]. The first
+// chunk reaching from is found by binary search; samples within a chunk
+// can only be decoded in order.
+func (s *memSeries) iter(from, to time.Time) *seriesIter {
+	t := from.UnixNano()
+	i := sort.Search(len(s.chunks), func(i int) bool { return s.chunks[i].maxT >= t })
+	return &seriesIter{chunks: s.chunks[i:], from: t, to: to.UnixNano()}
+}
+
+// between returns a copy of the samples of s in [from, to].
+func (s *memSeries) between(from, to time.Time) []types.SamplePoint {
+	out, _ := s.betweenAtMost(from, to, math.MaxInt)
+	return out
+}
+
+// betweenAtMost is between decoding no more than limit samples; ok is
+// false if there were more.
+func (s *memSeries) betweenAtMost(from, to time.Time, limit int) (out []types.SamplePoint, ok bool) {
+	it := s.iter(from, to)
+	n := 0
+	for _, c := range it.chunks {
+		if c.minT > it.to {
+			break
+		}
+		n += c.n
+	}
+	out = make([]types.SamplePoint, 0, min(n, limit))
+	for it.next() {
+		if len(out) == limit {
+			return out, false
+		}
+		out = append(out, it.at())
+	}
+	return out, true
+}
+
+type seriesIter struct {
+	chunks   []*chunk
+	from, to int64
+	cur      *chunkIter
+}
+
+func (it *seriesIter) next() bool {
+	for {
+		if it.cur == nil {
+			if len(it.chunks) == 0 || it.chunks[0].minT > it.to {
+				return false
+			}
+			it.cur = it.chunks[0].iter()
+			it.chunks = it.chunks[1:]
+		}
+		for it.cur.next() {
+			t, _ := it.cur.at()
+			if t > it.to {
+				return false
+			}
+			if t >= it.from {
+				return true
+			}
+		}
+		it.cur = nil
+	}
+}
+
+func (it *seriesIter) at() types.SamplePoint {
+	t, v := it.cur.at()
+	return types.SamplePoint{At: time.Unix(0, t).UTC(), V: v}
+}
+
+// seriesJSON is how a series is snapshotted. Points is only read, from
+// snapshots written before samples were stored in chunks.
+type seriesJSON struct {
+	Name   string              `json:"name"`
+	Labels types.Labels        `json:"labels,omitempty"`
+	Chunks []chunkJSON         `json:"chunks,omitempty"`
+	Points []types.SamplePoint `json:"points,omitempty"`
+}
+
+type chunkJSON struct {
+	N int    `json:"n"`
+	B []byte `json:"b"`
+}
+
+func (s *memSeries) MarshalJSON() ([]byte, error) {
+	out := seriesJSON{Name: s.name, Labels: s.labels, Chunks: make([]chunkJSON, len(s.chunks))}
+	for i, c := range s.chunks {
+		out.Chunks[i] = chunkJSON{N: c.n, B: c.b}
+	}
+	return json.Marshal(out)
+}
+
+func (s *memSeries) UnmarshalJSON(b []byte) error {
+	var in seriesJSON
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	s.name, s.labels, s.family = in.Name, in.Labels, familyOf(in.Name, in.Labels)
+	s.rollup = &rollup{}
+	for _, cj := range in.Chunks {
+		c, err := loadChunk(cj.B, cj.N)
+		if err != nil {
+			return fmt.Errorf("series %s: %w", types.SeriesID(in.Name, in.Labels), err)
+		}
+		s.chunks = append(s.chunks, c)
+		s.count += c.n
+	}
+	for _, p := range in.Points {
+		s.append(p.At, p.V, ringCap)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type rawSample struct {
+	t int64
+	v float64
+}
+
+// codecCases cover every timestamp and value encoding of a chunk.
+var codecCases = map[string][]rawSample{
+	"steady":    {{1e18, 1}, {1e18 + 30e9, 1}, {1e18 + 60e9, 1}, {1e18 + 90e9, 1}},
+	"jitter":    {{1e18, 0.5}, {1e18 + 30e9 + 3e5, 0.75}, {1e18 + 60e9 - 4e7, 0.25}, {1e18 + 90e9 + 2e10, 12.125}},
+	"same time": {{5, 1}, {5, 2}, {5, 2}},
+	"gaps":      {{0, 0}, {1, 1}, {math.MaxInt64 / 4, -1}, {math.MaxInt64 / 2, 1e300}, {math.MaxInt64 / 2, -1e-300}},
+	"special": {
+		{1, math.Inf(1)}, {2, math.Inf(-1)}, {3, math.NaN()}, {4, math.Copysign(0, -1)},
+		{5, math.SmallestNonzeroFloat64}, {6, math.MaxFloat64},
+	},
+}
+
+func randomSamples(n int) []rawSample {
+	r := rand.New(rand.NewPCG(1, 2))
+	out := make([]rawSample, n)
+	t, v := int64(1e18), 50.0
+	for i := range out {
+		t += 30e9 + r.Int64N(2e6) - 1e6
+		v = math.Round((v+r.NormFloat64())*100) / 100
+		out[i] = rawSample{t, v}
+	}
+	return out
+}
+
+func sameBits(a, b float64) bool { return math.Float64bits(a) == math.Float64bits(b) }
+
+func TestChunkRoundTrip(t *testing.T) {
+	cases := map[string][]rawSample{"random": randomSamples(chunkSamples)}
+	for name, in := range codecCases {
+		cases[name] = in
+	}
+	for name, in := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &chunk{}
+			for _, s := range in {
+				c.append(s.t, s.v)
+			}
+			checkChunk(t, c, in)
+
+			// A chunk loaded from its bytes takes further appends.
+			l, err := loadChunk(slices.Clone(c.b), c.n)
+			if err != nil {
+				t.Fatalf("loadChunk: %v", err)
+			}
+			for _, v := range []float64{7, 7, -3.5, math.NaN()} {
+				next := rawSample{in[len(in)-1].t + 30e9, v}
+				l.append(next.t, next.v)
+				in = append(in, next)
+			}
+			checkChunk(t, l, in)
+		})
+	}
+}
+
+func checkChunk(t *testing.T, c *chunk, want []rawSample) {
+	t.Helper()
+	var got []rawSample
+	for it := c.iter(); it.next(); {
+		ts, v := it.at()
+		got = append(got, rawSample{ts, v})
+	}
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].t != want[i].t || !sameBits(got[i].v, want[i].v) {
+			t.Fatalf("sample %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if c.minT != want[0].t || c.maxT != want[len(want)-1].t {
+		t.Errorf("time range = [%d, %d], want [%d, %d]", c.minT, c.maxT, want[0].t, want[len(want)-1].t)
+	}
+}
+
+func TestLoadChunkCorrupt(t *testing.T) {
+	c := &chunk{}
+	for _, s := range randomSamples(10) {
+		c.append(s.t, s.v)
+	}
+	if _, err := loadChunk(c.b[:len(c.b)/2], c.n); err == nil {
+		t.Error("loadChunk accepted a truncated chunk")
+	}
+}
+
+func TestSeriesJSONRoundTrip(t *testing.T) {
+	in := randomSamples(5*chunkSamples + 7)
+	s := &memSeries{name: "cpu_usage_percent", rollup: &rollup{}}
+	for _, p := range in {
+		s.append(time.Unix(0, p.t), p.v, len(in))
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got memSeries
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	pts := got.between(time.Unix(0, 0), time.Unix(0, math.MaxInt64))
+	if len(pts) != len(in) || got.count != len(in) {
+		t.Fatalf("decoded %d samples (count %d), want %d", len(pts), got.count, len(in))
+	}
+	for i, p := range pts {
+		if p.At.UnixNano() != in[i].t || !sameBits(p.V, in[i].v) {
+			t.Fatalf("sample %d = %v, want %v", i, p, in[i])
+		}
+	}
+}
+
+func TestSeriesAppendOutOfOrder(t *testing.T) {
+	s := &memSeries{rollup: &rollup{}}
+	at := time.Unix(100, 0)
+	if !s.append(at, 1, ringCap) || !s.append(at, 2, ringCap) {
+		t.Fatal("append refused an in-order sample")
+	}
+	if s.append(at.Add(-time.Nanosecond), 3, ringCap) {
+		t.Error("append took a sample older than the newest")
+	}
+	if s.count != 2 {
+		t.Errorf("count = %d, want 2", s.count)
+	}
+}
+
+// sliceSeries is how samples were stored before chunks: a ring of points.
+type sliceSeries struct{ points []types.SamplePoint }
+
+func (s *sliceSeries) append(at time.Time, v float64, ringCap int) {
+	s.points = keepLast(append(s.points, types.SamplePoint{At: at, V: v}), ringCap)
+}
+
+func (s *sliceSeries) between(from, to time.Time) []types.SamplePoint {
+	return slices.Clone(between(s.points, func(p types.SamplePoint) time.Time { return p.At }, from, to))
+}
+
+// benchRing is a 50k-sample ring: about 17 days at the 30s interval.
+const benchRing = 50_000
+
+func benchSamples() []types.SamplePoint {
+	raw := randomSamples(benchRing)
+	out := make([]types.SamplePoint, len(raw))
+	for i, s := range raw {
+		out[i] = types.SamplePoint{At: time.Unix(0, s.t).UTC(), V: s.v}
+	}
+	return out
+}
+
+// BenchmarkSeriesMemory reports the bytes a full ring takes.
+func BenchmarkSeriesMemory(b *testing.B) {
+	pts := benchSamples()
+	b.Run("chunks", func(b *testing.B) {
+		var size int
+		for range b.N {
+			s := &memSeries{rollup: &rollup{}}
+			for _, p := range pts {
+				s.append(p.At, p.V, benchRing)
+			}
+			size = cap(s.chunks) * int(unsafe.Sizeof(&chunk{}))
+			for _, c := range s.chunks {
+				size += int(unsafe.Sizeof(*c)) + cap(c.b)
+			}
+		}
+		b.ReportMetric(float64(size)/benchRing, "B/sample")
+	})
+	b.Run("slice", func(b *testing.B) {
+		var size int
+		for range b.N {
+			var s sliceSeries
+			for _, p := range pts {
+				s.append(p.At, p.V, benchRing)
+			}
+			size = cap(s.points) * int(unsafe.Sizeof(types.SamplePoint{}))
+		}
+		b.ReportMetric(float64(size)/benchRing, "B/sample")
+	})
+}
+
+// BenchmarkSeriesAppend appends to a full ring, so every append also trims.
+func BenchmarkSeriesAppend(b *testing.B) {
+	pts := benchSamples()
+	last := pts[len(pts)-1].At
+	b.Run("chunks", func(b *testing.B) {
+		s := &memSeries{rollup: &rollup{}}
+		for _, p := range pts {
+			s.append(p.At, p.V, benchRing)
+		}
+		b.ResetTimer()
+		for i := range b.N {
+			s.append(last.Add(time.Duration(i+1)*30*time.Second), float64(i%100), benchRing)
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		var s sliceSeries
+		for _, p := range pts {
+			s.append(p.At, p.V, benchRing)
+		}
+		b.ResetTimer()
+		for i := range b.N {
+			s.append(last.Add(time.Duration(i+1)*30*time.Second), float64(i%100), benchRing)
+		}
+	})
+}
+
+// BenchmarkSeriesBetween reads the last hour and the whole ring.
+func BenchmarkSeriesBetween(b *testing.B) {
+	pts := benchSamples()
+	chunks := &memSeries{rollup: &rollup{}}
+	var slice sliceSeries
+	for _, p := range pts {
+		chunks.append(p.At, p.V, benchRing)
+		slice.append(p.At, p.V, benchRing)
+	}
+	last := pts[len(pts)-1].At
+	for _, w := range []struct {
+		name     string
+		from, to time.Time
+	}{
+		{"1h", last.Add(-time.Hour), last},
+		{"all", pts[0].At, last},
+	} {
+		b.Run("chunks/"+w.name, func(b *testing.B) {
+			for range b.N {
+				chunks.between(w.from, w.to)
+			}
+		})
+		b.Run("slice/"+w.name, func(b *testing.B) {
+			for range b.N {
+				slice.between(w.from, w.to)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package store
+
+import "time"
+
+// StartCompactor applies the retention policies of m every interval until
+// stop is closed.
+func StartCompactor(m *Memory, every time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.PruneForRetention()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
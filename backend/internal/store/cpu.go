@@ -0,0 +1,165 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+var cpuFamily = &family[types.CPUPoint]{
+	at:     func(p types.CPUPoint) time.Time { return p.At },
+	labels: func(types.CPUPoint) types.Labels { return nil },
+	point:  func(at time.Time, _ types.Labels) types.CPUPoint { return types.CPUPoint{At: at} },
+	fields: []Field[types.CPUPoint]{
+		floatField("cpu_usage_percent", nil, func(p *types.CPUPoint) *float64 { return &p.V }),
+	},
+}
+
+// cpuTimesFamily stores the share of each state under one metric name, told
+// apart by a state label.
+var cpuTimesFamily = &family[types.CPUTimesPoint]{
+	at:     func(p types.CPUTimesPoint) time.Time { return p.At },
+	labels: func(types.CPUTimesPoint) types.Labels { return nil },
+	point:  func(at time.Time, _ types.Labels) types.CPUTimesPoint { return types.CPUTimesPoint{At: at} },
+	fields: []Field[types.CPUTimesPoint]{
+		floatField("cpu_time_percent", types.Labels{"state": "user"}, func(p *types.CPUTimesPoint) *float64 { return &p.User }),
+		floatField("cpu_time_percent", types.Labels{"state": "nice"}, func(p *types.CPUTimesPoint) *float64 { return &p.Nice }),
+		floatField("cpu_time_percent", types.Labels{"state": "system"}, func(p *types.CPUTimesPoint) *float64 { return &p.System }),
+		floatField("cpu_time_percent", types.Labels{"state": "idle"}, func(p *types.CPUTimesPoint) *float64 { return &p.Idle }),
+		floatField("cpu_time_percent", types.Labels{"state": "iowait"}, func(p *types.CPUTimesPoint) *float64 { return &p.Iowait }),
+		floatField("cpu_time_percent", types.Labels{"state": "irq"}, func(p *types.CPUTimesPoint) *float64 { return &p.Irq }),
+		floatField("cpu_time_percent", types.Labels{"state": "softirq"}, func(p *types.CPUTimesPoint) *float64 { return &p.Softirq }),
+		floatField("cpu_time_percent", types.Labels{"state": "steal"}, func(p *types.CPUTimesPoint) *float64 { return &p.Steal }),
+	},
+}
+
+var loadFamily = &family[types.LoadPoint]{
+	at:     func(p types.LoadPoint) time.Time { return p.At },
+	labels: func(types.LoadPoint) types.Labels { return nil },
+	point:  func(at time.Time, _ types.Labels) types.LoadPoint { return types.LoadPoint{At: at} },
+	fields: []Field[types.LoadPoint]{
+		floatField("load_average", types.Labels{"period": "1m"}, func(p *types.LoadPoint) *float64 { return &p.Load1 }),
+		floatField("load_average", types.Labels{"period": "5m"}, func(p *types.LoadPoint) *float64 { return &p.Load5 }),
+		floatField("load_average", types.Labels{"period": "15m"}, func(p *types.LoadPoint) *float64 { return &p.Load15 }),
+	},
+}
+
+// coreMetric holds the utilisation of each core, told apart by a core label
+// holding its index.
+const coreMetric = "cpu_core_usage_percent"
+
+func (m *Memory) SaveCPU(p types.CPUPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putCPU(p)
+	if err := m.persist("cpu", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicCPU, p.At, p)
+	return nil
+}
+func (m *Memory) SaveCPUCores(p types.CPUCoresPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putCPUCores(p)
+	if err := m.persist("cores", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicCPUCores, p.At, p)
+	return nil
+}
+func (m *Memory) SaveCPUTimes(p types.CPUTimesPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putCPUTimes(p)
+	if err := m.persist("cputimes", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicCPUTimes, p.At, p)
+	return nil
+}
+func (m *Memory) SaveLoad(p types.LoadPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putLoad(p)
+	if err := m.persist("load", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicLoad, p.At, p)
+	return nil
+}
+
+func (m *Memory) putCPU(p types.CPUPoint)           { putPoint(m, cpuFamily, p) }
+func (m *Memory) putCPUTimes(p types.CPUTimesPoint) { putPoint(m, cpuTimesFamily, p) }
+func (m *Memory) putLoad(p types.LoadPoint)         { putPoint(m, loadFamily, p) }
+func (m *Memory) putCPUCores(p types.CPUCoresPoint) {
+	for i, v := range p.Cores {
+		m.putSample(types.Sample{At: p.At, Name: coreMetric, Labels: types.Labels{"core": strconv.Itoa(i)}, Value: v})
+	}
+}
+
+func (m *Memory) CPUSince(since time.Time) []types.CPUPoint { return m.CPUBetween(since, time.Now()) }
+func (m *Memory) CPUBetween(from, to time.Time) []types.CPUPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	return onlyPoints(m, cpuFamily, from, to)
+}
+
+// CPUCoresBetween joins the per-core series on their timestamps. A core
+// without a sample at some time reads 0 there.
+func (m *Memory) CPUCoresBetween(from, to time.Time) []types.CPUCoresPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	var out []types.CPUCoresPoint
+	idx := map[int64]int{}
+	for _, id := range m.selectIDs([]types.Matcher{{Name: types.NameLabel, Value: coreMetric}, builtin}) {
+		core, err := strconv.Atoi(m.series[id].labels["core"])
+		if err != nil || core < 0 {
+			continue
+		}
+		for _, sp := range m.samplesBetween(id, from, to, false) {
+			j, ok := idx[sp.At.UnixNano()]
+			if !ok {
+				j = len(out)
+				idx[sp.At.UnixNano()] = j
+				out = append(out, types.CPUCoresPoint{At: sp.At})
+			}
+			for len(out[j].Cores) <= core {
+				out[j].Cores = append(out[j].Cores, 0)
+			}
+			out[j].Cores[core] = sp.V
+		}
+	}
+	sortByTime(out, func(p types.CPUCoresPoint) time.Time { return p.At })
+	return out
+}
+func (m *Memory) CPUTimesBetween(from, to time.Time) []types.CPUTimesPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	return onlyPoints(m, cpuTimesFamily, from, to)
+}
+func (m *Memory) LoadBetween(from, to time.Time) []types.LoadPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	return onlyPoints(m, loadFamily, from, to)
+}
+
+// keepSince drops the leading points of a time-ordered series that are
+// older than cutoff, reusing the backing array.
+func keepSince[P any](s []P, at func(P) time.Time, cutoff time.Time) []P {
+	i := sort.Search(len(s), func(i int) bool { return !at(s[i]).Before(cutoff) })
+	return s[:copy(s, s[i:])]
+}
+
+// between returns the part of a time-ordered series in [from, to], sharing
+// its backing array.
+func between[P any](s []P, at func(P) time.Time, from, to time.Time) []P {
+	i := sort.Search(len(s), func(i int) bool { return !at(s[i]).Before(from) })
+	j := sort.Search(len(s), func(j int) bool { return at(s[j]).After(to) })
+	if j < i {
+		return nil
+	}
+	return s[i:j]
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type DiskSeries struct {
+	Mount  string            `json:"mount"`
+	Points []types.DiskPoint `json:"points"`
+}
+
+var diskFamily = &family[types.DiskPoint]{
+	at:     func(p types.DiskPoint) time.Time { return p.At },
+	labels: func(p types.DiskPoint) types.Labels { return types.Labels{"mount": p.Mount} },
+	point: func(at time.Time, l types.Labels) types.DiskPoint {
+		return types.DiskPoint{At: at, Mount: l["mount"]}
+	},
+	fields: []Field[types.DiskPoint]{
+		floatField("disk_used_percent", nil, func(p *types.DiskPoint) *float64 { return &p.UsedPct }),
+		floatField("disk_used_gigabytes", nil, func(p *types.DiskPoint) *float64 { return &p.UsedGB }),
+		floatField("disk_total_gigabytes", nil, func(p *types.DiskPoint) *float64 { return &p.TotalGB }),
+		uintField("disk_inodes_used", nil, func(p *types.DiskPoint) *uint64 { return &p.InodesUsed }),
+		uintField("disk_inodes_free", nil, func(p *types.DiskPoint) *uint64 { return &p.InodesFree }),
+		floatField("disk_inodes_used_percent", nil, func(p *types.DiskPoint) *float64 { return &p.InodesUsedPct }),
+	},
+}
+
+func (m *Memory) SaveDisk(p types.DiskPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putDisk(p)
+	if err := m.persist("disk", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicDisk, p.At, p)
+	return nil
+}
+
+func (m *Memory) putDisk(p types.DiskPoint) { putPoint(m, diskFamily, p) }
+
+func (m *Memory) DiskSince(since time.Time) []DiskSeries { return m.DiskBetween(since, time.Now()) }
+
+// DiskBetween returns the series of every mount with samples in [from, to],
+// sorted by mount.
+func (m *Memory) DiskBetween(from, to time.Time) []DiskSeries {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	groups := pointsBetween(m, diskFamily, from, to)
+	res := make([]DiskSeries, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, DiskSeries{Mount: g.labels["mount"], Points: g.points})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Mount < res[j].Mount })
+	return res
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type DiskDeviceSeries struct {
+	Device string                  `json:"device"`
+	Points []types.DiskDevicePoint `json:"points"`
+}
+
+var diskIOFamily = &family[types.DiskIOPoint]{
+	at:     func(p types.DiskIOPoint) time.Time { return p.At },
+	labels: func(types.DiskIOPoint) types.Labels { return nil },
+	point:  func(at time.Time, _ types.Labels) types.DiskIOPoint { return types.DiskIOPoint{At: at} },
+	fields: []Field[types.DiskIOPoint]{
+		floatField("disk_read_megabytes_per_second", nil, func(p *types.DiskIOPoint) *float64 { return &p.ReadMBs }),
+		floatField("disk_write_megabytes_per_second", nil, func(p *types.DiskIOPoint) *float64 { return &p.WriteMBs }),
+	},
+}
+
+var diskDeviceFamily = &family[types.DiskDevicePoint]{
+	at:     func(p types.DiskDevicePoint) time.Time { return p.At },
+	labels: func(p types.DiskDevicePoint) types.Labels { return types.Labels{"device": p.Device} },
+	point: func(at time.Time, l types.Labels) types.DiskDevicePoint {
+		return types.DiskDevicePoint{At: at, Device: l["device"]}
+	},
+	fields: []Field[types.DiskDevicePoint]{
+		floatField("disk_device_read_bytes_per_second", nil, func(p *types.DiskDevicePoint) *float64 { return &p.ReadBytes }),
+		floatField("disk_device_write_bytes_per_second", nil, func(p *types.DiskDevicePoint) *float64 { return &p.WriteBytes }),
+		floatField("disk_device_read_iops", nil, func(p *types.DiskDevicePoint) *float64 { return &p.ReadIOPS }),
+		floatField("disk_device_write_iops", nil, func(p *types.DiskDevicePoint) *float64 { return &p.WriteIOPS }),
+		floatField("disk_device_await_milliseconds", nil, func(p *types.DiskDevicePoint) *float64 { return &p.AwaitMs }),
+		floatField("disk_device_util_percent", nil, func(p *types.DiskDevicePoint) *float64 { return &p.UtilPct }),
+	},
+}
+
+func (m *Memory) SaveDiskIO(p types.DiskIOPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putDiskIO(p)
+	if err := m.persist("diskio", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicDiskIO, p.At, p)
+	return nil
+}
+func (m *Memory) SaveDiskDevice(p types.DiskDevicePoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putDiskDevice(p)
+	if err := m.persist("diskdev", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicDiskDevice, p.At, p)
+	return nil
+}
+
+func (m *Memory) putDiskIO(p types.DiskIOPoint)         { putPoint(m, diskIOFamily, p) }
+func (m *Memory) putDiskDevice(p types.DiskDevicePoint) { putPoint(m, diskDeviceFamily, p) }
+
+func (m *Memory) DiskIOSince(since time.Time) []types.DiskIOPoint {
+	return m.DiskIOBetween(since, time.Now())
+}
+func (m *Memory) DiskIOBetween(from, to time.Time) []types.DiskIOPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	return onlyPoints(m, diskIOFamily, from, to)
+}
+
+// DiskDevices lists every block device with stored samples.
+func (m *Memory) DiskDevices() []string {
+	return m.LabelValues(diskDeviceFamily.fields[0].name, "device")
+}
+
+// DiskDeviceBetween returns the series of every device with samples in
+// [from, to], sorted by device name.
+func (m *Memory) DiskDeviceBetween(from, to time.Time) []DiskDeviceSeries {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	groups := pointsBetween(m, diskDeviceFamily, from, to)
+	res := make([]DiskDeviceSeries, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, DiskDeviceSeries{Device: g.labels["device"], Points: g.points})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Device < res[j].Device })
+	return res
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// Topics a stream subscriber can ask for.
+const (
+	TopicCPU        = "cpu"
+	TopicCPUCores   = "cpucores"
+	TopicCPUTimes   = "cputimes"
+	TopicLoad       = "load"
+	TopicMem        = "mem"
+	TopicMemDetail  = "memdetail"
+	TopicDisk       = "disk"
+	TopicDiskIO     = "diskio"
+	TopicDiskDevice = "diskdev"
+	TopicNet        = "net"
+	TopicNetIface   = "netiface"
+	TopicPressure   = "pressure"
+	TopicCgroup     = "cgroup"
+	TopicSensor     = "sensor"
+	TopicSocket     = "socket"
+	TopicPorts      = "ports"
+	TopicSample     = "sample"
+	TopicProcesses  = "processes"
+	TopicLogs       = "logs"
+	TopicTasks      = "tasks"
+)
+
+var Topics = []string{
+	TopicCPU, TopicCPUCores, TopicCPUTimes, TopicLoad, TopicMem, TopicMemDetail,
+	TopicDisk, TopicDiskIO, TopicDiskDevice, TopicNet, TopicNetIface, TopicPressure, TopicCgroup,
+	TopicSensor, TopicSocket, TopicPorts, TopicSample, TopicProcesses, TopicLogs, TopicTasks,
+}
+
+// subBuffer is how many events a subscriber may lag behind before it is
+// dropped.
+const subBuffer = 64
+
+// Event is one change pushed to subscribers.
+type Event struct {
+	Topic string    `json:"topic"`
+	At    time.Time `json:"t"`
+	Data  any       `json:"data"`
+}
+
+// Subscription receives events on C until it is closed, either by the
+// subscriber or by the hub when the subscriber falls too far behind.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	topics map[string]bool
+	hub    *hub
+}
+
+// Close stops delivery and releases the subscription.
+func (s *Subscription) Close() { s.hub.remove(s) }
+
+// hub fans events out to subscribers without ever blocking the publisher.
+type hub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+func (h *hub) subscribe(topics ...string) *Subscription {
+	c := make(chan Event, subBuffer)
+	s := &Subscription{C: c, c: c, hub: h}
+	if len(topics) > 0 {
+		s.topics = make(map[string]bool, len(topics))
+		for _, t := range topics {
+			s.topics[t] = true
+		}
+	}
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]struct{})
+	}
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *hub) remove(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+func (h *hub) publish(topic string, at time.Time, data any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := Event{Topic: topic, At: at, Data: data}
+	for s := range h.subs {
+		if s.topics != nil && !s.topics[topic] {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			delete(h.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the given topics, or to every topic
+// when none are given.
+func (m *Memory) Subscribe(topics ...string) *Subscription { return m.hub.subscribe(topics...) }
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+var memFamily = &family[types.MemPoint]{
+	at:     func(p types.MemPoint) time.Time { return p.At },
+	labels: func(types.MemPoint) types.Labels { return nil },
+	point:  func(at time.Time, _ types.Labels) types.MemPoint { return types.MemPoint{At: at} },
+	fields: []Field[types.MemPoint]{
+		floatField("memory_used_percent", nil, func(p *types.MemPoint) *float64 { return &p.V }),
+	},
+}
+
+var memDetailFamily = &family[types.MemDetailPoint]{
+	at:     func(p types.MemDetailPoint) time.Time { return p.At },
+	labels: func(types.MemDetailPoint) types.Labels { return nil },
+	point:  func(at time.Time, _ types.Labels) types.MemDetailPoint { return types.MemDetailPoint{At: at} },
+	fields: []Field[types.MemDetailPoint]{
+		uintField("memory_total_bytes", nil, func(p *types.MemDetailPoint) *uint64 { return &p.Total }),
+		uintField("memory_available_bytes", nil, func(p *types.MemDetailPoint) *uint64 { return &p.Available }),
+		uintField("memory_used_bytes", nil, func(p *types.MemDetailPoint) *uint64 { return &p.Used }),
+		uintField("memory_cached_bytes", nil, func(p *types.MemDetailPoint) *uint64 { return &p.Cached }),
+		uintField("memory_buffers_bytes", nil, func(p *types.MemDetailPoint) *uint64 { return &p.Buffers }),
+		uintField("swap_used_bytes", nil, func(p *types.MemDetailPoint) *uint64 { return &p.SwapUsed }),
+		uintField("swap_total_bytes", nil, func(p *types.MemDetailPoint) *uint64 { return &p.SwapTotal }),
+		floatField("memory_major_faults_per_second", nil, func(p *types.MemDetailPoint) *float64 { return &p.MajorFaultsPerSec }),
+	},
+}
+
+func (m *Memory) SaveMem(p types.MemPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putMem(p)
+	if err := m.persist("mem", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicMem, p.At, p)
+	return nil
+}
+func (m *Memory) SaveMemDetail(p types.MemDetailPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putMemDetail(p)
+	if err := m.persist("memdetail", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicMemDetail, p.At, p)
+	return nil
+}
+
+func (m *Memory) putMem(p types.MemPoint)             { putPoint(m, memFamily, p) }
+func (m *Memory) putMemDetail(p types.MemDetailPoint) { putPoint(m, memDetailFamily, p) }
+
+func (m *Memory) MemSince(since time.Time) []types.MemPoint { return m.MemBetween(since, time.Now()) }
+func (m *Memory) MemBetween(from, to time.Time) []types.MemPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	return onlyPoints(m, memFamily, from, to)
+}
+func (m *Memory) MemDetailBetween(from, to time.Time) []types.MemDetailPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	return onlyPoints(m, memDetailFamily, from, to)
+}
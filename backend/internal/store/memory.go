@@ -17,31 +17,58 @@ import (
 
 var ErrNotFound = errors.New("not found")
 
-const retention = 30 * 24 * time.Hour
 const ringCap = 50000
 
 type Memory struct {
+	// mu guards everything but the series. Writers of samples hold it too,
+	// which orders them with each other and in the log.
 	mu sync.RWMutex
 
 	items map[string]*types.Item
 
-	cpuPoints  []types.CPUPoint
-	memPoints  []types.MemPoint
-	diskSeries map[string][]types.DiskPoint
-	diskIO     []types.DiskIOPoint
-	netIO      []types.NetPoint
+	// series holds every metric by series ID; postings maps each label
+	// pair, and the metric name under types.NameLabel, to the IDs of the
+	// series carrying it. seriesMu guards both maps and each series its own
+	// samples, so a writer appending to one series holds up reads of no
+	// other. Locks are taken in the order mu, seriesMu, a series.
+	seriesMu sync.RWMutex
+	series   map[string]*memSeries
+	postings map[string]map[string]struct{}
+	// retention is written holding both mu and seriesMu, so holding either
+	// is enough to read it.
+	retention Retention
+	// savedRetention holds the policies changed with SetRetention, which
+	// snapshots keep; nil if none was.
+	savedRetention Retention
+	// migrating is set while a snapshot from before the generic series is
+	// loaded, whose rollups are converted rather than rebuilt.
+	migrating bool
+	// outOfOrder counts the samples putSample dropped.
+	outOfOrder uint64
+
+	ports     types.PortSnapshot
+	processes []types.ProcessSnapshot
 
 	logs  []LogEntry
 	tasks map[string]*Task
 
 	lastCollector time.Time
+
+	// snapMu serialises snapshots, which copy the state under mu but write
+	// it out without.
+	snapMu sync.Mutex
+	wal    *wal
+	hub    hub
 }
 
 func NewMemory() *Memory {
 	return &Memory{
-		items:      make(map[string]*types.Item),
-		diskSeries: make(map[string][]types.DiskPoint),
-		tasks:      make(map[string]*Task),
+		items:    make(map[string]*types.Item),
+		series:   make(map[string]*memSeries),
+		postings: make(map[string]map[string]struct{}),
+		tasks:    make(map[string]*Task),
+
+		retention: DefaultRetention(),
 	}
 }
 func (m *Memory) now() time.Time { return time.Now().UTC() }
@@ -71,6 +98,7 @@ func (m *Memory) Create(title, notes string) *types.Item {
 	it := &types.Item{ID: uuid.NewString(), Title: title, Notes: notes, CreatedAt: now, UpdatedAt: now}
 	m.mu.Lock()
 	m.items[it.ID] = it
+	m.persistOrLog("item", it)
 	m.mu.Unlock()
 	return it
 }
@@ -86,6 +114,9 @@ func (m *Memory) Update(id, title, notes string) (*types.Item, error) {
 	}
 	it.Notes = notes
 	it.UpdatedAt = m.now()
+	if err := m.persist("item", it); err != nil {
+		return nil, err
+	}
 	return it, nil
 }
 func (m *Memory) Delete(id string) error {
@@ -95,198 +126,35 @@ func (m *Memory) Delete(id string) error {
 		return ErrNotFound
 	}
 	delete(m.items, id)
-	return nil
-}
-
-func (m *Memory) SaveCPU(p types.CPUPoint) error {
-	m.mu.Lock()
-	m.cpuPoints = appendCapCPU(m.cpuPoints, p)
-	m.mu.Unlock()
-	return nil
-}
-func (m *Memory) SaveMem(p types.MemPoint) error {
-	m.mu.Lock()
-	m.memPoints = appendCapMem(m.memPoints, p)
-	m.mu.Unlock()
-	return nil
-}
-func (m *Memory) SaveDisk(p types.DiskPoint) error {
-	m.mu.Lock()
-	series := append(m.diskSeries[p.Mount], p)
-	if len(series) > ringCap {
-		series = series[len(series)-ringCap:]
-	}
-	m.diskSeries[p.Mount] = series
-	m.mu.Unlock()
-	return nil
-}
-func (m *Memory) SaveDiskIO(p types.DiskIOPoint) error {
-	m.mu.Lock()
-	m.diskIO = appendCapDiskIO(m.diskIO, p)
-	m.mu.Unlock()
-	return nil
-}
-func (m *Memory) SaveNet(p types.NetPoint) error {
-	m.mu.Lock()
-	m.netIO = appendCapNet(m.netIO, p)
-	m.mu.Unlock()
-	return nil
-}
-
-func appendCapCPU(s []types.CPUPoint, v types.CPUPoint) []types.CPUPoint {
-	s = append(s, v)
-	if len(s) > ringCap {
-		return s[len(s)-ringCap:]
-	}
-	return s
-}
-func appendCapMem(s []types.MemPoint, v types.MemPoint) []types.MemPoint {
-	s = append(s, v)
-	if len(s) > ringCap {
-		return s[len(s)-ringCap:]
-	}
-	return s
-}
-func appendCapDiskIO(s []types.DiskIOPoint, v types.DiskIOPoint) []types.DiskIOPoint {
-	s = append(s, v)
-	if len(s) > ringCap {
-		return s[len(s)-ringCap:]
-	}
-	return s
-}
-func appendCapNet(s []types.NetPoint, v types.NetPoint) []types.NetPoint {
-	s = append(s, v)
-	if len(s) > ringCap {
-		return s[len(s)-ringCap:]
-	}
-	return s
-}
-
-func (m *Memory) CPUSince(since time.Time) []types.CPUPoint {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	var out []types.CPUPoint
-	for _, p := range m.cpuPoints {
-		if !p.At.Before(since) {
-			out = append(out, p)
-		}
-	}
-	return out
-}
-func (m *Memory) MemSince(since time.Time) []types.MemPoint {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	var out []types.MemPoint
-	for _, p := range m.memPoints {
-		if !p.At.Before(since) {
-			out = append(out, p)
-		}
-	}
-	return out
-}
-
-type DiskSeries struct {
-	Mount  string            `json:"mount"`
-	Points []types.DiskPoint `json:"points"`
-}
-
-func (m *Memory) DiskSince(since time.Time) []DiskSeries {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	res := make([]DiskSeries, 0, len(m.diskSeries))
-	for mount, series := range m.diskSeries {
-		var pts []types.DiskPoint
-		for _, p := range series {
-			if !p.At.Before(since) {
-				pts = append(pts, p)
-			}
-		}
-		if len(pts) > 0 {
-			res = append(res, DiskSeries{Mount: mount, Points: pts})
-		}
-	}
-	sort.Slice(res, func(i, j int) bool { return res[i].Mount < res[j].Mount })
-	return res
-}
-func (m *Memory) DiskIOSince(since time.Time) []types.DiskIOPoint {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	var out []types.DiskIOPoint
-	for _, p := range m.diskIO {
-		if !p.At.Before(since) {
-			out = append(out, p)
-		}
-	}
-	return out
-}
-func (m *Memory) NetSince(since time.Time) []types.NetPoint {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	var out []types.NetPoint
-	for _, p := range m.netIO {
-		if !p.At.Before(since) {
-			out = append(out, p)
-		}
-	}
-	return out
+	return m.persist("itemdel", id)
 }
 
+// PruneOlderThan drops raw samples and rollup buckets older than cutoff.
 func (m *Memory) PruneOlderThan(cutoff time.Time) error {
+	m.pruneSeries(func(s *memSeries) {
+		s.dropBefore(cutoff)
+		for t := 1; t < len(tiers); t++ {
+			pruneBuckets(s.rollup, t, cutoff)
+		}
+	})
 	m.mu.Lock()
 	defer m.mu.Unlock()
-
-	dstCPU := m.cpuPoints[:0]
-	for _, p := range m.cpuPoints {
-		if !p.At.Before(cutoff) {
-			dstCPU = append(dstCPU, p)
-		}
-	}
-	m.cpuPoints = dstCPU
-
-	dstMem := m.memPoints[:0]
-	for _, p := range m.memPoints {
-		if !p.At.Before(cutoff) {
-			dstMem = append(dstMem, p)
-		}
-	}
-	m.memPoints = dstMem
-
-	for k, series := range m.diskSeries {
-		dst := series[:0]
-		for _, p := range series {
-			if !p.At.Before(cutoff) {
-				dst = append(dst, p)
-			}
-		}
-		m.diskSeries[k] = dst
-	}
-
-	dstIO := m.diskIO[:0]
-	for _, p := range m.diskIO {
-		if !p.At.Before(cutoff) {
-			dstIO = append(dstIO, p)
-		}
-	}
-	m.diskIO = dstIO
-
-	dstNet := m.netIO[:0]
-	for _, p := range m.netIO {
-		if !p.At.Before(cutoff) {
-			dstNet = append(dstNet, p)
-		}
-	}
-	m.netIO = dstNet
-
+	m.processes = keepSince(m.processes, func(s types.ProcessSnapshot) time.Time { return s.At }, cutoff)
+	m.dropEmptySeries()
 	return nil
 }
-func (m *Memory) PruneForRetention() { _ = m.PruneOlderThan(time.Now().Add(-retention)) }
 
 func (m *Memory) LastCollector() time.Time {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return m.lastCollector
 }
-func (m *Memory) SetLastCollector(t time.Time) { m.mu.Lock(); m.lastCollector = t; m.mu.Unlock() }
+func (m *Memory) SetLastCollector(t time.Time) {
+	m.mu.Lock()
+	m.lastCollector = t
+	m.persistOrLog("collector", t)
+	m.mu.Unlock()
+}
 
 type LogEntry struct {
 	At    time.Time `json:"t"`
@@ -294,26 +162,51 @@ type LogEntry struct {
 	Msg   string    `json:"msg"`
 }
 
+// AddLog records a log entry on behalf of the collector or other callers
+// outside the store.
+func (m *Memory) AddLog(level, msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addLog(level, msg)
+}
+
 func (m *Memory) addLog(level, msg string) {
-	m.logs = append(m.logs, LogEntry{At: time.Now().UTC(), Level: level, Msg: msg})
-	if len(m.logs) > ringCap {
-		m.logs = m.logs[len(m.logs)-ringCap:]
-	}
+	e := LogEntry{At: time.Now().UTC(), Level: level, Msg: msg}
+	m.putLog(e)
+	m.persistOrLog("log", e)
+	m.hub.publish(TopicLogs, e.At, e)
+}
+func (m *Memory) putLog(e LogEntry) {
+	m.logs = keepLast(append(m.logs, e), m.retention.policy("logs").RingCap)
 }
 func (m *Memory) ListLogs(limit int, filter string) []LogEntry {
+	return m.listLogs(limit, filter, func(logs []LogEntry) []LogEntry { return logs })
+}
+
+// LogsBetween is ListLogs restricted to entries logged in [from, to].
+func (m *Memory) LogsBetween(from, to time.Time, limit int, filter string) []LogEntry {
+	return m.listLogs(limit, filter, func(logs []LogEntry) []LogEntry {
+		return between(logs, func(e LogEntry) time.Time { return e.At }, from, to)
+	})
+}
+
+// listLogs returns the latest entries of the span of m.logs that span
+// picks, newest first.
+func (m *Memory) listLogs(limit int, filter string, span func([]LogEntry) []LogEntry) []LogEntry {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if limit <= 0 || limit > 1000 {
 		limit = 1000
 	}
 	filter = strings.ToLower(strings.TrimSpace(filter))
-	n := len(m.logs)
+	logs := span(m.logs)
+	n := len(logs)
 	out := make([]LogEntry, 0, min(limit, n))
 	for i := n - 1; i >= 0 && len(out) < limit; i-- {
-		if filter != "" && !strings.Contains(strings.ToLower(m.logs[i].Msg), filter) {
+		if filter != "" && !strings.Contains(strings.ToLower(logs[i].Msg), filter) {
 			continue
 		}
-		out = append(out, m.logs[i])
+		out = append(out, logs[i])
 	}
 	return out
 }
@@ -338,7 +231,8 @@ func (m *Memory) ListTasks() []*Task {
 	defer m.mu.RUnlock()
 	out := make([]*Task, 0, len(m.tasks))
 	for _, t := range m.tasks {
-		out = append(out, t)
+		cp := *t
+		out = append(out, &cp)
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
 	return out
@@ -347,9 +241,12 @@ func (m *Memory) CreateTask(name string, every int) *Task {
 	t := &Task{ID: uuid.NewString(), Name: name, EveryMinutes: every, Enabled: true}
 	m.mu.Lock()
 	m.tasks[t.ID] = t
+	m.persistOrLog("task", t)
 	m.addLog("INFO", "task created: "+name)
+	cp := *t
+	m.hub.publish(TopicTasks, m.now(), cp)
 	m.mu.Unlock()
-	return t
+	return &cp
 }
 func (m *Memory) DeleteTask(id string) error {
 	m.mu.Lock()
@@ -359,6 +256,10 @@ func (m *Memory) DeleteTask(id string) error {
 		return ErrNotFound
 	}
 	delete(m.tasks, id)
+	if err := m.persist("taskdel", id); err != nil {
+		return err
+	}
+	m.hub.publish(TopicTasks, m.now(), map[string]any{"id": id, "deleted": true})
 	m.addLog("INFO", "task deleted: "+t.Name)
 	return nil
 }
@@ -366,12 +267,15 @@ func (m *Memory) DeleteTask(id string) error {
 func (m *Memory) RunTaskNow(id string) error {
 	m.mu.Lock()
 	t, ok := m.tasks[id]
+	var name string
+	if ok {
+		name = strings.ToLower(strings.TrimSpace(t.Name))
+	}
 	m.mu.Unlock()
 	if !ok {
 		return ErrNotFound
 	}
 
-	name := strings.ToLower(strings.TrimSpace(t.Name))
 	var err error
 	switch {
 	case strings.Contains(name, "dns"):
@@ -384,41 +288,25 @@ func (m *Memory) RunTaskNow(id string) error {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	// The task may have been deleted while it ran; logging it again would
+	// bring it back on replay.
+	if t, ok = m.tasks[id]; !ok {
+		return ErrNotFound
+	}
 	if err != nil {
 		t.Status = "ERR"
 		t.LastRun = time.Now().UTC()
+		perr := m.persist("task", t)
+		m.hub.publish(TopicTasks, t.LastRun, *t)
 		m.addLog("ERROR", "task failed: "+t.Name+" ("+err.Error()+")")
-		return err
+		return errors.Join(err, perr)
 	}
 	t.Status = "OK"
 	t.LastRun = time.Now().UTC()
+	perr := m.persist("task", t)
+	m.hub.publish(TopicTasks, t.LastRun, *t)
 	m.addLog("INFO", "task ran: "+t.Name)
-	return nil
-}
-
-func (m *Memory) StartScheduler(stop <-chan struct{}) {
-	ticker := time.NewTicker(time.Minute)
-	go func() {
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				m.mu.RLock()
-				now := time.Now().UTC()
-				for id, t := range m.tasks {
-					if !t.Enabled || t.EveryMinutes <= 0 {
-						continue
-					}
-					if t.LastRun.IsZero() || now.Sub(t.LastRun) >= time.Duration(t.EveryMinutes)*time.Minute {
-						go func(id string) { _ = m.RunTaskNow(id) }(id)
-					}
-				}
-				m.mu.RUnlock()
-			case <-stop:
-				return
-			}
-		}
-	}()
+	return perr
 }
 
 func clearTemp() error {
@@ -0,0 +1,23 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/store/storetest"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store { return store.NewMemory() })
+}
+
+func TestPersistent(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		m, err := store.Open(t.TempDir(), store.DefaultRetention())
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		t.Cleanup(func() { m.Close() })
+		return m
+	})
+}
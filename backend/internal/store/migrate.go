@@ -0,0 +1,155 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// migrate loads the typed series of a snapshot written before every metric
+// was stored as generic series. Raw points are split into samples as if they
+// were saved again; rollups, which held one value per field under keys such
+// as "disk:/home", are split into the rollups of the field series. Callers
+// must own m exclusively.
+func (m *Memory) migrate(l *legacySeries, rollups map[string]*rollup) {
+	m.migrating = true
+	defer func() { m.migrating = false }()
+
+	for _, p := range l.CPU {
+		m.putCPU(p)
+	}
+	for _, p := range l.CPUCores {
+		m.putCPUCores(p)
+	}
+	for _, p := range l.CPUTimes {
+		m.putCPUTimes(p)
+	}
+	for _, p := range l.Load {
+		m.putLoad(p)
+	}
+	for _, p := range l.Mem {
+		m.putMem(p)
+	}
+	for _, p := range l.MemDetail {
+		m.putMemDetail(p)
+	}
+	for _, series := range l.Disk {
+		for _, p := range series {
+			m.putDisk(p)
+		}
+	}
+	for _, p := range l.DiskIO {
+		m.putDiskIO(p)
+	}
+	for _, series := range l.DiskDevices {
+		for _, p := range series {
+			m.putDiskDevice(p)
+		}
+	}
+	for _, p := range l.Net {
+		m.putNet(p)
+	}
+	for _, series := range l.NetIfaces {
+		for _, p := range series {
+			m.putNetIface(p)
+		}
+	}
+	for _, series := range l.Pressure {
+		for _, p := range series {
+			m.putPressure(p)
+		}
+	}
+	for _, series := range l.Cgroups {
+		for _, p := range series {
+			m.putCgroup(p)
+		}
+	}
+	for _, series := range l.Sensors {
+		for _, p := range series {
+			m.putSensor(p)
+		}
+	}
+	for _, series := range l.Sockets {
+		for _, p := range series {
+			m.putSocket(p)
+		}
+	}
+
+	for key, r := range rollups {
+		if strings.HasPrefix(key, "series:") {
+			continue
+		}
+		fields := legacyFields(key, r)
+		for i, f := range fields {
+			_, series := m.seriesFor(f.Name, f.Labels)
+			split := &rollup{Tiers: make([][]bucket, len(r.Tiers))}
+			for t, bs := range r.Tiers {
+				for _, b := range bs {
+					if i < len(b.Sum) {
+						split.Tiers[t] = append(split.Tiers[t], bucket{
+							At: b.At, Count: b.Count,
+							Min: []float64{b.Min[i]}, Max: []float64{b.Max[i]}, Sum: []float64{b.Sum[i]},
+						})
+					}
+				}
+			}
+			series.rollup = split
+		}
+	}
+}
+
+// legacyFields returns the series each value of a legacy rollup belongs to,
+// in the order the values were observed. Unknown keys yield none.
+func legacyFields(key string, r *rollup) []types.Series {
+	kind, id, _ := strings.Cut(key, ":")
+	switch kind {
+	case "cpu":
+		return cpuFamily.series(nil)
+	case "cores":
+		n := 0
+		for _, bs := range r.Tiers {
+			for _, b := range bs {
+				n = max(n, len(b.Sum))
+			}
+		}
+		out := make([]types.Series, n)
+		for i := range out {
+			out[i] = types.Series{Name: coreMetric, Labels: types.Labels{"core": strconv.Itoa(i)}}
+		}
+		return out
+	case "cputimes":
+		return cpuTimesFamily.series(nil)
+	case "load":
+		return loadFamily.series(nil)
+	case "mem":
+		return memFamily.series(nil)
+	case "memdetail":
+		return memDetailFamily.series(nil)
+	case "disk":
+		return diskFamily.series(types.Labels{"mount": id})
+	case "diskio":
+		return diskIOFamily.series(nil)
+	case "diskdev":
+		return diskDeviceFamily.series(types.Labels{"device": id})
+	case "net":
+		if id == "" {
+			return netFamily.series(nil)
+		}
+		return netIfaceFamily.series(types.Labels{"iface": id})
+	case "pressure":
+		return pressureFamily.series(types.Labels{"resource": id})
+	case "cgroup":
+		return cgroupFamily.series(types.Labels{"path": id})
+	case "sensor":
+		parts := strings.SplitN(id, "/", 3)
+		if len(parts) != 3 {
+			return nil
+		}
+		return sensorFamily.series(types.Labels{"kind": parts[0], "chip": parts[1], "sensor": parts[2]})
+	case "socket":
+		proto, state, _ := strings.Cut(id, "/")
+		return socketFamily.series(types.Labels{"protocol": proto, "state": state})
+	}
+	return nil
+}
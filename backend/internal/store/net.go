@@ -0,0 +1,86 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type NetIfaceSeries struct {
+	Iface  string                `json:"iface"`
+	Points []types.NetIfacePoint `json:"points"`
+}
+
+var netFamily = &family[types.NetPoint]{
+	at:     func(p types.NetPoint) time.Time { return p.At },
+	labels: func(types.NetPoint) types.Labels { return nil },
+	point:  func(at time.Time, _ types.Labels) types.NetPoint { return types.NetPoint{At: at} },
+	fields: []Field[types.NetPoint]{
+		floatField("net_receive_kilobytes_per_second", nil, func(p *types.NetPoint) *float64 { return &p.RxKBs }),
+		floatField("net_transmit_kilobytes_per_second", nil, func(p *types.NetPoint) *float64 { return &p.TxKBs }),
+	},
+}
+
+var netIfaceFamily = &family[types.NetIfacePoint]{
+	at:     func(p types.NetIfacePoint) time.Time { return p.At },
+	labels: func(p types.NetIfacePoint) types.Labels { return types.Labels{"iface": p.Iface} },
+	point: func(at time.Time, l types.Labels) types.NetIfacePoint {
+		return types.NetIfacePoint{At: at, Iface: l["iface"]}
+	},
+	fields: []Field[types.NetIfacePoint]{
+		floatField("net_iface_receive_bytes_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.RxBytes }),
+		floatField("net_iface_transmit_bytes_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.TxBytes }),
+		floatField("net_iface_receive_packets_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.RxPackets }),
+		floatField("net_iface_transmit_packets_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.TxPackets }),
+		floatField("net_iface_receive_errors_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.RxErrors }),
+		floatField("net_iface_transmit_errors_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.TxErrors }),
+		floatField("net_iface_receive_drops_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.RxDrops }),
+		floatField("net_iface_transmit_drops_per_second", nil, func(p *types.NetIfacePoint) *float64 { return &p.TxDrops }),
+	},
+}
+
+func (m *Memory) SaveNet(p types.NetPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putNet(p)
+	if err := m.persist("net", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicNet, p.At, p)
+	return nil
+}
+func (m *Memory) SaveNetIface(p types.NetIfacePoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putNetIface(p)
+	if err := m.persist("netiface", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicNetIface, p.At, p)
+	return nil
+}
+
+func (m *Memory) putNet(p types.NetPoint)           { putPoint(m, netFamily, p) }
+func (m *Memory) putNetIface(p types.NetIfacePoint) { putPoint(m, netIfaceFamily, p) }
+
+func (m *Memory) NetSince(since time.Time) []types.NetPoint { return m.NetBetween(since, time.Now()) }
+func (m *Memory) NetBetween(from, to time.Time) []types.NetPoint {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	return onlyPoints(m, netFamily, from, to)
+}
+
+// NetIfaceBetween returns the series of every interface with samples in
+// [from, to], sorted by interface name.
+func (m *Memory) NetIfaceBetween(from, to time.Time) []NetIfaceSeries {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	groups := pointsBetween(m, netIfaceFamily, from, to)
+	res := make([]NetIfaceSeries, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, NetIfaceSeries{Iface: g.labels["iface"], Points: g.points})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Iface < res[j].Iface })
+	return res
+}
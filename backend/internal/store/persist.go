@@ -0,0 +1,581 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+)
+
+// record is one line of the write-ahead log. Seq increases monotonically
+// across snapshots so records already folded into a snapshot can be skipped
+// on replay.
+type record struct {
+	Seq  uint64          `json:"seq"`
+	Kind string          `json:"k"`
+	Data json.RawMessage `json:"d"`
+}
+
+type snapshot struct {
+	Seq           uint64                  `json:"seq"`
+	TakenAt       time.Time               `json:"takenAt"`
+	Items         map[string]*types.Item  `json:"items"`
+	Series        map[string]*memSeries   `json:"series"`
+	Rollups       map[string]*rollup      `json:"rollups"`
+	Ports         types.PortSnapshot      `json:"ports"`
+	Processes     []types.ProcessSnapshot `json:"processes"`
+	Logs          []LogEntry              `json:"logs"`
+	Tasks         map[string]*Task        `json:"tasks"`
+	LastCollector time.Time               `json:"lastCollector"`
+	Retention     Retention               `json:"retention,omitempty"`
+
+	legacySeries
+}
+
+// legacySeries holds the typed series of snapshots written before every
+// metric was stored as generic series. They are only read, see migrate.
+type legacySeries struct {
+	CPU         []types.CPUPoint                   `json:"cpu,omitempty"`
+	CPUCores    []types.CPUCoresPoint              `json:"cores,omitempty"`
+	CPUTimes    []types.CPUTimesPoint              `json:"cputimes,omitempty"`
+	Load        []types.LoadPoint                  `json:"load,omitempty"`
+	Mem         []types.MemPoint                   `json:"mem,omitempty"`
+	MemDetail   []types.MemDetailPoint             `json:"memdetail,omitempty"`
+	Disk        map[string][]types.DiskPoint       `json:"disk,omitempty"`
+	DiskIO      []types.DiskIOPoint                `json:"diskio,omitempty"`
+	DiskDevices map[string][]types.DiskDevicePoint `json:"diskdevices,omitempty"`
+	Net         []types.NetPoint                   `json:"net,omitempty"`
+	NetIfaces   map[string][]types.NetIfacePoint   `json:"netifaces,omitempty"`
+	Pressure    map[string][]types.PressurePoint   `json:"pressure,omitempty"`
+	Cgroups     map[string][]types.CgroupPoint     `json:"cgroups,omitempty"`
+	Sensors     map[string][]types.SensorPoint     `json:"sensors,omitempty"`
+	Sockets     map[string][]types.SocketPoint     `json:"sockets,omitempty"`
+}
+
+type wal struct {
+	dir   string
+	seq   uint64
+	dirty atomic.Bool // records were written since the last sync
+
+	// mu keeps rotate and Close from swapping or closing f during a sync.
+	// Writers reach f under Memory.mu, which rotate and Close also hold.
+	mu sync.Mutex
+	f  *os.File
+}
+
+// sync flushes the log to disk if records were written since the last
+// sync. It does not need Memory.mu, so writers and readers carry on while
+// the disk catches up.
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil || !w.dirty.Swap(false) {
+		return nil
+	}
+	if err := w.f.Sync(); err != nil {
+		w.dirty.Store(true)
+		return err
+	}
+	return nil
+}
+
+// Open returns a Memory backed by dir and keeping data for r, overridden by
+// the policies last set with SetRetention. The last snapshot is loaded and
+// the write-ahead log replayed on top of it; a torn tail left by a crash is
+// truncated away. Every subsequent mutation is appended to the log until
+// the next Snapshot. Appends reach the disk on the next Sync, Snapshot or
+// Close; see StartSyncer.
+func Open(dir string, r Retention) (*Memory, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m := NewMemory()
+	m.retention = r
+
+	var seq uint64
+	snap, err := readSnapshot(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return nil, err
+	}
+	if snap != nil {
+		m.restore(snap)
+		seq = snap.Seq
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	last, err := m.replay(f, seq)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if last > seq {
+		seq = last
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	m.wal = &wal{dir: dir, f: f, seq: seq}
+	m.PruneForRetention()
+	return m, nil
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// replay applies every complete record after skip. A final line without
+// its newline was torn by a crash mid-write and is truncated away. A
+// complete line that cannot be decoded or applied, such as a record of a
+// kind this version does not know, is skipped and reported in the logs, so
+// the records after it are kept. It returns the highest sequence seen.
+func (m *Memory) replay(f *os.File, skip uint64) (uint64, error) {
+	r := bufio.NewReader(f)
+	var off int64
+	last := skip
+	var bad []error
+	defer func() {
+		if len(bad) > 0 {
+			msg := fmt.Sprintf("write-ahead log: skipped %d unreadable records, the first: %v", len(bad), bad[0])
+			log.Print(msg)
+			m.putLog(LogEntry{At: m.now(), Level: "ERROR", Msg: msg})
+		}
+	}()
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return last, f.Truncate(off)
+			}
+			return last, nil
+		}
+		if err != nil {
+			return last, err
+		}
+		off += int64(len(line))
+		var rec record
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			bad = append(bad, fmt.Errorf("at byte %d: %w", off-int64(len(line)), err))
+			continue
+		}
+		if rec.Seq > last {
+			last = rec.Seq
+		}
+		if err := m.apply(rec, skip); err != nil {
+			bad = append(bad, fmt.Errorf("record %d: %w", rec.Seq, err))
+		}
+	}
+}
+
+func (m *Memory) apply(rec record, skip uint64) error {
+	if rec.Seq <= skip {
+		return nil
+	}
+	switch rec.Kind {
+	case "cpu":
+		var p types.CPUPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putCPU(p)
+	case "cores":
+		var p types.CPUCoresPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putCPUCores(p)
+	case "cputimes":
+		var p types.CPUTimesPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putCPUTimes(p)
+	case "load":
+		var p types.LoadPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putLoad(p)
+	case "mem":
+		var p types.MemPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putMem(p)
+	case "memdetail":
+		var p types.MemDetailPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putMemDetail(p)
+	case "disk":
+		var p types.DiskPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putDisk(p)
+	case "diskio":
+		var p types.DiskIOPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putDiskIO(p)
+	case "diskdev":
+		var p types.DiskDevicePoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putDiskDevice(p)
+	case "net":
+		var p types.NetPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putNet(p)
+	case "pressure":
+		var p types.PressurePoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putPressure(p)
+	case "cgroup":
+		var p types.CgroupPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putCgroup(p)
+	case "sensor":
+		var p types.SensorPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putSensor(p)
+	case "socket":
+		var p types.SocketPoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putSocket(p)
+	case "ports":
+		var s types.PortSnapshot
+		if err := json.Unmarshal(rec.Data, &s); err != nil {
+			return err
+		}
+		m.ports = s
+	case "sample":
+		var s types.Sample
+		if err := json.Unmarshal(rec.Data, &s); err != nil {
+			return err
+		}
+		m.putSample(s)
+	case "netiface":
+		var p types.NetIfacePoint
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		m.putNetIface(p)
+	case "procs":
+		var s types.ProcessSnapshot
+		if err := json.Unmarshal(rec.Data, &s); err != nil {
+			return err
+		}
+		m.putProcesses(s)
+	case "log":
+		var e LogEntry
+		if err := json.Unmarshal(rec.Data, &e); err != nil {
+			return err
+		}
+		m.putLog(e)
+	case "task":
+		var t Task
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return err
+		}
+		m.tasks[t.ID] = &t
+	case "taskdel":
+		var id string
+		if err := json.Unmarshal(rec.Data, &id); err != nil {
+			return err
+		}
+		delete(m.tasks, id)
+	case "item":
+		var it types.Item
+		if err := json.Unmarshal(rec.Data, &it); err != nil {
+			return err
+		}
+		m.items[it.ID] = &it
+	case "itemdel":
+		var id string
+		if err := json.Unmarshal(rec.Data, &id); err != nil {
+			return err
+		}
+		delete(m.items, id)
+	case "collector":
+		var t time.Time
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return err
+		}
+		m.lastCollector = t
+	case "retention":
+		var r Retention
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return err
+		}
+		m.restoreRetention(r)
+	default:
+		return fmt.Errorf("unknown record kind %q", rec.Kind)
+	}
+	return nil
+}
+
+// persist appends a record to the log. It is flushed to disk by the next
+// Sync, so that writers holding m.mu never wait for the disk. Callers must
+// hold m.mu.
+func (m *Memory) persist(kind string, v any) error {
+	if m.wal == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(record{Seq: m.wal.seq + 1, Kind: kind, Data: data})
+	if err != nil {
+		return err
+	}
+	if _, err := m.wal.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	m.wal.seq++
+	m.wal.dirty.Store(true)
+	return nil
+}
+
+// Sync flushes the records logged since the last Sync to disk. It is a
+// no-op for a Memory created with NewMemory.
+func (m *Memory) Sync() error {
+	m.mu.RLock()
+	w := m.wal
+	m.mu.RUnlock()
+	if w == nil {
+		return nil
+	}
+	return w.sync()
+}
+
+// persistOrLog is persist for callers with no error to return; a failure is
+// logged instead. Callers must hold m.mu.
+func (m *Memory) persistOrLog(kind string, v any) {
+	if err := m.persist(kind, v); err != nil {
+		log.Printf("store: persist %s: %v", kind, err)
+	}
+}
+
+func (m *Memory) restore(s *snapshot) {
+	if s.Items != nil {
+		m.items = s.Items
+	}
+	if s.Series != nil {
+		m.series = s.Series
+	}
+	for id, series := range m.series {
+		m.index(id, series)
+		if r, ok := s.Rollups["series:"+id]; ok {
+			series.rollup = r
+		}
+	}
+	m.migrate(&s.legacySeries, s.Rollups)
+	m.ports = s.Ports
+	m.processes = s.Processes
+	m.logs = s.Logs
+	if s.Tasks != nil {
+		m.tasks = s.Tasks
+	}
+	m.lastCollector = s.LastCollector
+	if s.Retention != nil {
+		m.restoreRetention(s.Retention)
+	}
+}
+
+// Snapshot writes the full state to disk and resets the write-ahead log.
+// It is a no-op for a Memory created with NewMemory.
+//
+// Writers wait only while the state is copied, one series at a time, and
+// readers not at all; encoding and writing happen after the locks are
+// released. Records logged meanwhile are carried over into the new log.
+func (m *Memory) Snapshot() error {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+
+	m.mu.RLock()
+	if m.wal == nil {
+		m.mu.RUnlock()
+		return nil
+	}
+	s, off, err := m.copyState()
+	dir := m.wal.dir
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, snapshotFile), b); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.wal.rotate(off)
+}
+
+// copyState copies everything a snapshot holds, along with the log offset
+// it covers. Callers must hold m.mu for reading, which keeps writers out.
+func (m *Memory) copyState() (snapshot, int64, error) {
+	off, err := m.wal.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return snapshot{}, 0, err
+	}
+	s := snapshot{
+		Seq:           m.wal.seq,
+		TakenAt:       m.now(),
+		Items:         make(map[string]*types.Item, len(m.items)),
+		Ports:         m.ports,
+		Processes:     slices.Clone(m.processes),
+		Logs:          slices.Clone(m.logs),
+		Tasks:         make(map[string]*Task, len(m.tasks)),
+		LastCollector: m.lastCollector,
+		Retention:     m.savedRetention,
+	}
+	for id, it := range m.items {
+		c := *it
+		s.Items[id] = &c
+	}
+	for id, t := range m.tasks {
+		c := *t
+		s.Tasks[id] = &c
+	}
+
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	s.Series = make(map[string]*memSeries, len(m.series))
+	s.Rollups = make(map[string]*rollup, len(m.series))
+	for id, ser := range m.series {
+		c := ser.clone()
+		s.Series[id] = c
+		if !emptyRollup(c.rollup) {
+			s.Rollups["series:"+id] = c.rollup
+		}
+	}
+	return s, off, nil
+}
+
+// rotate replaces the log by the records written from off on, those not
+// in the snapshot just taken. The new log is synced and renamed into place,
+// so a crash leaves either log whole. Callers must hold Memory.mu.
+func (w *wal) rotate(off int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	end, err := w.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	tail := make([]byte, end-off)
+	if _, err := w.f.ReadAt(tail, off); err != nil {
+		return err
+	}
+	path := filepath.Join(w.dir, walFile)
+	if err := writeFileAtomic(path, tail); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	w.f.Close()
+	w.f = f
+	w.dirty.Store(false)
+	return nil
+}
+
+// Close takes a final snapshot, syncs whatever the snapshot could not
+// cover and releases the log file.
+func (m *Memory) Close() error {
+	err := m.Snapshot()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if w := m.wal; w != nil {
+		if serr := w.sync(); err == nil {
+			err = serr
+		}
+		w.mu.Lock()
+		if cerr := w.f.Close(); err == nil {
+			err = cerr
+		}
+		w.f = nil
+		w.mu.Unlock()
+		m.wal = nil
+	}
+	return err
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
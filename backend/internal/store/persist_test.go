@@ -0,0 +1,191 @@
+package store_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// crashCopy copies the files of the store in dir to a new directory, as a
+// crash would leave them.
+func crashCopy(t *testing.T, dir string) string {
+	t.Helper()
+	out := t.TempDir()
+	for _, name := range []string{"snapshot.json", "wal.log"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(out, name), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+func TestSnapshotKeepsConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	m, err := store.Open(dir, store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	const n = 2000
+	start := time.Now().Add(-time.Hour)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := m.Snapshot(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := range n {
+		at := start.Add(time.Duration(i) * time.Second)
+		if err := m.SaveSample(types.Sample{At: at, Name: "queue_depth", Labels: types.Labels{"job": "q"}, Value: float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	r, err := store.Open(crashCopy(t, dir), store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	got := r.Select(start, start.Add(n*time.Second))
+	if len(got) != 1 || len(got[0].Points) != n {
+		t.Fatalf("after reopen: %d series, want 1 with %d samples", len(got), n)
+	}
+	for i, p := range got[0].Points {
+		if p.V != float64(i) {
+			t.Fatalf("sample %d = %v, want %d", i, p.V, i)
+		}
+	}
+}
+
+func TestSyncWhileWriting(t *testing.T) {
+	dir := t.TempDir()
+	m, err := store.Open(dir, store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	const n = 1000
+	start := time.Now().Add(-time.Hour)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := m.Sync(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := range n {
+		at := start.Add(time.Duration(i) * time.Second)
+		if err := m.SaveSample(types.Sample{At: at, Name: "queue_depth", Value: float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if i == n/2 {
+			if err := m.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := m.Sync(); err != nil {
+		t.Errorf("Sync after Close: %v", err)
+	}
+
+	r, err := store.Open(dir, store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	got := r.Select(start, start.Add(n*time.Second))
+	if len(got) != 1 || len(got[0].Points) != n {
+		t.Fatalf("after reopen: %d series, want 1 with %d samples", len(got), n)
+	}
+}
+
+func TestReplaySkipsBadRecords(t *testing.T) {
+	src := t.TempDir()
+	m, err := store.Open(src, store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	m.Create("first", "")
+	m.Create("second", "")
+
+	dir := crashCopy(t, src)
+	path := filepath.Join(dir, "wal.log")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	// A garbled line and a record of an unknown kind between the two items,
+	// and a torn write at the end.
+	wal := lines[0] + "{not json\n" + `{"seq":99,"k":"future","d":{}}` + "\n" + lines[1] + `{"seq":100,"k":"it`
+	if err := os.WriteFile(path, []byte(wal), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := store.Open(dir, store.DefaultRetention())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer r.Close()
+	var titles []string
+	for _, it := range r.List() {
+		titles = append(titles, it.Title)
+	}
+	if len(titles) != 2 {
+		t.Fatalf("items after replay = %v, want first and second", titles)
+	}
+	if logs := r.ListLogs(10, "unreadable"); len(logs) != 1 || !strings.Contains(logs[0].Msg, "skipped 2") {
+		t.Errorf("logs = %+v, want one entry reporting 2 skipped records", logs)
+	}
+
+	b, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "\n") {
+		t.Errorf("torn tail was not truncated: %q", b)
+	}
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type PressureSeries struct {
+	Resource string                `json:"resource"`
+	Points   []types.PressurePoint `json:"points"`
+}
+
+// pressureFamily rolls the cumulative totals up as the bucket maximum, so
+// they stay cumulative.
+var pressureFamily = &family[types.PressurePoint]{
+	at:     func(p types.PressurePoint) time.Time { return p.At },
+	labels: func(p types.PressurePoint) types.Labels { return types.Labels{"resource": p.Resource} },
+	point: func(at time.Time, l types.Labels) types.PressurePoint {
+		return types.PressurePoint{At: at, Resource: l["resource"]}
+	},
+	fields: []Field[types.PressurePoint]{
+		floatField("pressure_some_avg10_percent", nil, func(p *types.PressurePoint) *float64 { return &p.SomeAvg10 }),
+		floatField("pressure_some_avg60_percent", nil, func(p *types.PressurePoint) *float64 { return &p.SomeAvg60 }),
+		floatField("pressure_some_avg300_percent", nil, func(p *types.PressurePoint) *float64 { return &p.SomeAvg300 }),
+		uintField("pressure_some_stall_microseconds_total", nil, func(p *types.PressurePoint) *uint64 { return &p.SomeTotal }).rolledUpAsMax(),
+		floatField("pressure_full_avg10_percent", nil, func(p *types.PressurePoint) *float64 { return &p.FullAvg10 }),
+		floatField("pressure_full_avg60_percent", nil, func(p *types.PressurePoint) *float64 { return &p.FullAvg60 }),
+		floatField("pressure_full_avg300_percent", nil, func(p *types.PressurePoint) *float64 { return &p.FullAvg300 }),
+		uintField("pressure_full_stall_microseconds_total", nil, func(p *types.PressurePoint) *uint64 { return &p.FullTotal }).rolledUpAsMax(),
+	},
+}
+
+func (m *Memory) SavePressure(p types.PressurePoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putPressure(p)
+	if err := m.persist("pressure", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicPressure, p.At, p)
+	return nil
+}
+
+func (m *Memory) putPressure(p types.PressurePoint) { putPoint(m, pressureFamily, p) }
+
+// PressureResources lists every resource with stored pressure samples. It is
+// empty when the kernel does not expose pressure-stall information.
+func (m *Memory) PressureResources() []string {
+	return m.LabelValues(pressureFamily.fields[0].name, "resource")
+}
+
+// PressureBetween returns the series of every resource with samples in
+// [from, to], sorted by resource name.
+func (m *Memory) PressureBetween(from, to time.Time) []PressureSeries {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	groups := pointsBetween(m, pressureFamily, from, to)
+	res := make([]PressureSeries, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, PressureSeries{Resource: g.labels["resource"], Points: g.points})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Resource < res[j].Resource })
+	return res
+}
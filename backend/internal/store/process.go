@@ -0,0 +1,40 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// procHistory is how many process snapshots are kept by default; at the
+// default 30s collection period that is one hour.
+const procHistory = 120
+
+func (m *Memory) SaveProcesses(s types.ProcessSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putProcesses(s)
+	if err := m.persist("procs", s); err != nil {
+		return err
+	}
+	m.hub.publish(TopicProcesses, s.At, s)
+	return nil
+}
+
+func (m *Memory) putProcesses(s types.ProcessSnapshot) {
+	m.processes = keepLast(append(m.processes, s), m.retention.policy("processes").RingCap)
+}
+
+// ProcessesAt returns a copy of the latest snapshot taken at or before at.
+func (m *Memory) ProcessesAt(at time.Time) (types.ProcessSnapshot, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := sort.Search(len(m.processes), func(i int) bool { return m.processes[i].At.After(at) })
+	if i > 0 {
+		s := m.processes[i-1]
+		s.Processes = append([]types.ProcessInfo(nil), s.Processes...)
+		return s, true
+	}
+	return types.ProcessSnapshot{}, false
+}
@@ -0,0 +1,337 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// Families lists the families retention is configured for: the series of
+// each builtin collector, named after it, the series of exec collectors,
+// and process snapshots and logs, which have only a raw tier.
+var Families = []string{
+	"cpu", "memory", "disk", "diskio", "net", "pressure", "cgroups", "sensors", "sockets",
+	"exec", "processes", "logs",
+}
+
+// Policy is how long one family is kept: Keep[i] is the retention of
+// tiers[i], and at most RingCap raw samples are kept per series, or
+// snapshots or entries for processes and logs. Those two have no rollups
+// and so only a raw retention.
+type Policy struct {
+	Keep    []time.Duration
+	RingCap int
+}
+
+// Retention holds the policy of each family. Families it lacks get the
+// default policy.
+type Retention map[string]Policy
+
+const day = 24 * time.Hour
+
+// familyKeep is the default retention of the families that do not take
+// that of the tiers: logs are read for about a week, process snapshots
+// only while recent, and disk usage grows slowly enough to be worth a
+// year at 5m resolution.
+var familyKeep = map[string][]time.Duration{
+	"logs":      {7 * day},
+	"processes": {day},
+	"disk":      {30 * day, 365 * day, 2 * 365 * day},
+}
+
+func defaultPolicy(family string) Policy {
+	p := Policy{Keep: make([]time.Duration, tierCount(family)), RingCap: ringCap}
+	for i, t := range tiers[:len(p.Keep)] {
+		p.Keep[i] = t.Retention
+	}
+	copy(p.Keep, familyKeep[family])
+	if family == "processes" {
+		p.RingCap = procHistory
+	}
+	return p
+}
+
+// tierCount is how many tiers a policy of family has, so how long its Keep
+// must be.
+func tierCount(family string) int {
+	if family == "processes" || family == "logs" {
+		return 1
+	}
+	return len(tiers)
+}
+
+// validate reports the first policy of r that names an unknown family or
+// does not give every tier of its family a positive retention.
+func (r Retention) validate() error {
+	for _, f := range slices.Sorted(maps.Keys(r)) {
+		p := r[f]
+		if !slices.Contains(Families, f) {
+			return fmt.Errorf("retention: unknown family %q", f)
+		}
+		if n := tierCount(f); len(p.Keep) != n {
+			return fmt.Errorf("retention: %s needs %d tiers, got %d", f, n, len(p.Keep))
+		}
+		for i, d := range p.Keep {
+			if d <= 0 {
+				return fmt.Errorf("retention: %s %s must be positive", f, tiers[i].Name)
+			}
+		}
+		if p.RingCap <= 0 {
+			return fmt.Errorf("retention: %s ring cap must be positive", f)
+		}
+	}
+	return nil
+}
+
+func (r Retention) policy(family string) Policy {
+	if p, ok := r[family]; ok {
+		return p
+	}
+	return defaultPolicy(family)
+}
+
+// DefaultRetention returns the default policy of every family.
+func DefaultRetention() Retention {
+	r := Retention{}
+	for _, f := range Families {
+		r[f] = defaultPolicy(f)
+	}
+	return r
+}
+
+// RetentionFromEnv reads the retention of each tier from RETENTION_RAW,
+// RETENTION_5M and RETENTION_1H, which leave the families of familyKeep
+// at their own defaults, overridden per family by e.g. RETENTION_DISK_RAW
+// or RETENTION_LOGS_RAW, and the ring cap of a family from e.g.
+// RING_CAP_EXEC. Retentions take Go durations or whole days such
+// as "30d". Unset values keep the default; an invalid one is an error
+// naming the variable.
+func RetentionFromEnv() (Retention, error) {
+	r := DefaultRetention()
+	keep := func(key string, d *time.Duration) error {
+		s := os.Getenv(key)
+		if s == "" {
+			return nil
+		}
+		v, ok := parseKeep(s)
+		if !ok {
+			return fmt.Errorf("retention: %s=%q: want a positive duration such as 12h or 30d", key, s)
+		}
+		*d = v
+		return nil
+	}
+	for _, f := range Families {
+		p := r[f]
+		for i, t := range tiers[:len(p.Keep)] {
+			// The family keeps its own default unless it is set by name.
+			if _, ok := familyKeep[f]; !ok {
+				if err := keep("RETENTION_"+strings.ToUpper(t.Name), &p.Keep[i]); err != nil {
+					return nil, err
+				}
+			}
+			if err := keep("RETENTION_"+strings.ToUpper(f+"_"+t.Name), &p.Keep[i]); err != nil {
+				return nil, err
+			}
+		}
+		key := "RING_CAP_" + strings.ToUpper(f)
+		if s := os.Getenv(key); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("retention: %s=%q: want a positive integer", key, s)
+			}
+			p.RingCap = n
+		}
+		r[f] = p
+	}
+	return r, nil
+}
+
+func parseKeep(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * day, err == nil && n > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+// seriesFamilies maps the metric names of the builtin collectors to their
+// family.
+var seriesFamilies = map[string]string{coreMetric: "cpu"}
+
+func init() {
+	for family, names := range map[string][][]string{
+		"cpu":      {cpuFamily.names(), cpuTimesFamily.names(), loadFamily.names()},
+		"memory":   {memFamily.names(), memDetailFamily.names()},
+		"disk":     {diskFamily.names()},
+		"diskio":   {diskIOFamily.names(), diskDeviceFamily.names()},
+		"net":      {netFamily.names(), netIfaceFamily.names()},
+		"pressure": {pressureFamily.names()},
+		"cgroups":  {cgroupFamily.names()},
+		"sensors":  {sensorFamily.names()},
+		"sockets":  {socketFamily.names()},
+	} {
+		for _, ns := range names {
+			for _, n := range ns {
+				seriesFamilies[n] = family
+			}
+		}
+	}
+}
+
+// familyOf returns the family of a series. Anything not saved by a builtin
+// collector, which never sets a job label, belongs to exec.
+func familyOf(name string, labels map[string]string) string {
+	if f, ok := seriesFamilies[name]; ok && labels["job"] == "" {
+		return f
+	}
+	return "exec"
+}
+
+// SetRetention replaces the retention policies. They apply to samples saved
+// from now on and at the next PruneForRetention. An invalid policy is
+// rejected and the old ones are kept. The policies that change are logged
+// and outlive a restart: Open lays them over the retention it is given,
+// which still decides the families never changed here.
+func (m *Memory) SetRetention(r Retention) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := Retention{}
+	for _, f := range Families {
+		if p, old := r.policy(f), m.retention.policy(f); p.RingCap != old.RingCap || !slices.Equal(p.Keep, old.Keep) {
+			changed[f] = p
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	if err := m.persist("retention", changed); err != nil {
+		return err
+	}
+	m.seriesMu.Lock()
+	defer m.seriesMu.Unlock()
+	m.restoreRetention(changed)
+	return nil
+}
+
+// restoreRetention lays r, policies changed by SetRetention, over the
+// retention in force. A saved policy this version rejects, such as one for
+// a family since removed, is logged and skipped. Callers must hold m.mu
+// and m.seriesMu or be loading the store.
+func (m *Memory) restoreRetention(r Retention) {
+	merged, saved := maps.Clone(m.retention), maps.Clone(m.savedRetention)
+	if saved == nil {
+		saved = Retention{}
+	}
+	for f, p := range r {
+		if err := (Retention{f: p}).validate(); err != nil {
+			log.Printf("store: saved retention: %v", err)
+			continue
+		}
+		merged[f], saved[f] = p, p
+	}
+	m.retention, m.savedRetention = merged, saved
+}
+
+// PruneForRetention applies the policy of every family. Series are pruned
+// one at a time, holding up neither readers nor writers of the others.
+func (m *Memory) PruneForRetention() {
+	now := time.Now()
+	m.pruneSeries(func(s *memSeries) {
+		p := m.retention.policy(s.family)
+		s.dropBefore(now.Add(-p.Keep[0]))
+		s.trim(p.RingCap)
+		for t := 1; t < len(tiers); t++ {
+			pruneBuckets(s.rollup, t, now.Add(-p.Keep[t]))
+		}
+	})
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.retention.policy("processes")
+	m.processes = keepSince(m.processes, func(s types.ProcessSnapshot) time.Time { return s.At }, now.Add(-p.Keep[0]))
+	m.processes = keepLast(m.processes, p.RingCap)
+	p = m.retention.policy("logs")
+	m.logs = keepSince(m.logs, func(e LogEntry) time.Time { return e.At }, now.Add(-p.Keep[0]))
+	m.logs = keepLast(m.logs, p.RingCap)
+	m.dropEmptySeries()
+}
+
+// keepLast drops all but the last n elements of s.
+func keepLast[T any](s []T, n int) []T {
+	if len(s) > n {
+		return s[len(s)-n:]
+	}
+	return s
+}
+
+// RetentionStatus is the policy of one family and how far back its data
+// reaches.
+type RetentionStatus struct {
+	Family  string
+	RingCap int
+	Series  int
+	Tiers   []TierStatus
+}
+
+// TierStatus is one tier of a family. Step is 0 for raw samples; Oldest is
+// the start of the oldest sample or bucket, zero if there is none.
+type TierStatus struct {
+	Name   string
+	Step   time.Duration
+	Keep   time.Duration
+	Oldest time.Time
+}
+
+// RetentionStatus reports every family in Families, in that order.
+func (m *Memory) RetentionStatus() []RetentionStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	byFamily := map[string]*RetentionStatus{}
+	out := make([]RetentionStatus, len(Families))
+	for i, f := range Families {
+		p := m.retention.policy(f)
+		out[i] = RetentionStatus{Family: f, RingCap: p.RingCap}
+		for t, keep := range p.Keep {
+			out[i].Tiers = append(out[i].Tiers, TierStatus{Name: tiers[t].Name, Step: tiers[t].Step, Keep: keep})
+		}
+		byFamily[f] = &out[i]
+	}
+	older := func(st *RetentionStatus, t int, at time.Time) {
+		if o := &st.Tiers[t].Oldest; o.IsZero() || at.Before(*o) {
+			*o = at
+		}
+	}
+	for _, s := range m.series {
+		st := byFamily[s.family]
+		st.Series++
+		s.mu.RLock()
+		if len(s.chunks) > 0 {
+			older(st, 0, time.Unix(0, s.chunks[0].minT).UTC())
+		}
+		for t, bs := range s.rollup.Tiers {
+			if len(bs) > 0 {
+				older(st, t+1, bs[0].At)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	if len(m.processes) > 0 {
+		older(byFamily["processes"], 0, m.processes[0].At)
+	}
+	if len(m.logs) > 0 {
+		older(byFamily["logs"], 0, m.logs[0].At)
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package store_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+)
+
+const day = 24 * time.Hour
+
+func TestDefaultRetention(t *testing.T) {
+	r := store.DefaultRetention()
+	for f, want := range map[string][]time.Duration{
+		"cpu":       {30 * day, 30 * day, 365 * day},
+		"exec":      {30 * day, 30 * day, 365 * day},
+		"disk":      {30 * day, 365 * day, 2 * 365 * day},
+		"logs":      {7 * day},
+		"processes": {day},
+	} {
+		if got := r[f].Keep; !slices.Equal(got, want) {
+			t.Errorf("%s keeps %v, want %v", f, got, want)
+		}
+	}
+}
+
+func TestRetentionFromEnv(t *testing.T) {
+	t.Setenv("RETENTION_RAW", "10d")
+	t.Setenv("RETENTION_LOGS_RAW", "48h")
+	t.Setenv("RING_CAP_EXEC", "500")
+	r, err := store.RetentionFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RETENTION_RAW leaves the families with their own defaults alone.
+	for f, want := range map[string]time.Duration{"cpu": 10 * day, "disk": 30 * day, "logs": 2 * day, "processes": day} {
+		if got := r[f].Keep[0]; got != want {
+			t.Errorf("%s raw = %v, want %v", f, got, want)
+		}
+	}
+	if r["exec"].RingCap != 500 {
+		t.Errorf("exec ring cap = %d, want 500", r["exec"].RingCap)
+	}
+
+	for key, val := range map[string]string{
+		"RETENTION_5M":       "5 days",
+		"RETENTION_DISK_1H":  "-1h",
+		"RETENTION_LOGS_RAW": "0d",
+		"RING_CAP_SENSORS":   "lots",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, val)
+			if _, err := store.RetentionFromEnv(); err == nil || !strings.Contains(err.Error(), key) {
+				t.Errorf("%s=%q: err = %v, want one naming the variable", key, val, err)
+			}
+		})
+	}
+}
+
+func TestSetRetentionPersists(t *testing.T) {
+	dir := t.TempDir()
+	m, err := store.Open(dir, store.DefaultRetention())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := store.DefaultRetention()
+	r["disk"] = store.Policy{Keep: []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour}, RingCap: 10}
+	if err := m.SetRetention(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The policy is replayed from the log, then read from a snapshot, and
+	// wins over the retention Open is given for its family only.
+	env := store.DefaultRetention()
+	env["cpu"] = store.Policy{Keep: []time.Duration{day, day, day}, RingCap: 5}
+	for _, step := range []string{"log", "snapshot"} {
+		m, err := store.Open(dir, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range m.RetentionStatus() {
+			switch s.Family {
+			case "disk":
+				if s.RingCap != 10 || s.Tiers[0].Keep != time.Hour || s.Tiers[2].Keep != 3*time.Hour {
+					t.Errorf("%s: disk = %+v, want the saved policy", step, s)
+				}
+			case "cpu":
+				if s.RingCap != 5 || s.Tiers[0].Keep != day {
+					t.Errorf("%s: cpu = %+v, want the policy Open was given", step, s)
+				}
+			}
+		}
+		if err := m.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSetRetentionValidates(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		edit func(store.Retention)
+		want string
+	}{
+		{"short keep", func(r store.Retention) { p := r["disk"]; p.Keep = p.Keep[:2]; r["disk"] = p }, "disk needs 3 tiers, got 2"},
+		{"long keep", func(r store.Retention) { p := r["logs"]; p.Keep = append(p.Keep, time.Hour); r["logs"] = p }, "logs needs 1 tiers, got 2"},
+		{"zero keep", func(r store.Retention) { r["net"].Keep[1] = 0 }, "net 5m must be positive"},
+		{"zero ring cap", func(r store.Retention) { p := r["exec"]; p.RingCap = 0; r["exec"] = p }, "exec ring cap must be positive"},
+		{"unknown family", func(r store.Retention) { r["gpu"] = r["cpu"] }, `unknown family "gpu"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := store.NewMemory()
+			r := store.DefaultRetention()
+			tc.edit(r)
+			err := m.SetRetention(r)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("SetRetention = %v, want an error containing %q", err, tc.want)
+			}
+			// The store keeps its old policy and can still be pruned.
+			m.PruneForRetention()
+			if _, err := store.Open(t.TempDir(), r); err == nil {
+				t.Error("Open accepted the same retention")
+			}
+		})
+	}
+	if err := store.NewMemory().SetRetention(store.DefaultRetention()); err != nil {
+		t.Errorf("SetRetention(DefaultRetention()) = %v", err)
+	}
+}
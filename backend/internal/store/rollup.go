@@ -0,0 +1,162 @@
+package store
+
+import (
+	"slices"
+	"time"
+)
+
+// tier is one storage resolution. Tier 0 holds the raw samples as saved by
+// the collector; every following tier folds samples into fixed buckets.
+// Retention is the default that a Policy overrides per family.
+type tier struct {
+	Name      string
+	Step      time.Duration
+	Retention time.Duration
+}
+
+var tiers = []tier{
+	{Name: "raw", Step: 0, Retention: 30 * 24 * time.Hour},
+	{Name: "5m", Step: 5 * time.Minute, Retention: 30 * 24 * time.Hour},
+	{Name: "1h", Step: time.Hour, Retention: 365 * 24 * time.Hour},
+}
+
+// maxPoints is roughly how many points a *Since query should return. The
+// requested resolution is the queried span divided by it.
+const maxPoints = 1000
+
+// bucket aggregates every sample of a series that falls into
+// [At, At+step). Each slice holds one entry per field of the series.
+type bucket struct {
+	At    time.Time `json:"t"`
+	Count int       `json:"n"`
+	Min   []float64 `json:"min"`
+	Max   []float64 `json:"max"`
+	Sum   []float64 `json:"sum"`
+}
+
+func (b bucket) avg(i int) float64 {
+	if b.Count == 0 || i >= len(b.Sum) {
+		return 0
+	}
+	return b.Sum[i] / float64(b.Count)
+}
+
+// rollup holds the buckets of one series, Tiers[i] belonging to tiers[i+1].
+type rollup struct {
+	Tiers [][]bucket `json:"tiers"`
+}
+
+// observe folds one sample into every tier of r.
+func (r *rollup) observe(at time.Time, vals ...float64) {
+	for len(r.Tiers) < len(tiers)-1 {
+		r.Tiers = append(r.Tiers, nil)
+	}
+	for i, t := range tiers[1:] {
+		r.Tiers[i] = addToBuckets(r.Tiers[i], at.Truncate(t.Step), vals)
+	}
+}
+
+func addToBuckets(bs []bucket, start time.Time, vals []float64) []bucket {
+	for i := len(bs) - 1; i >= 0; i-- {
+		if bs[i].At.Equal(start) {
+			mergeInto(&bs[i], vals)
+			return bs
+		}
+		if bs[i].At.Before(start) {
+			break
+		}
+	}
+
+	b := bucket{
+		At:    start,
+		Count: 1,
+		Min:   append([]float64(nil), vals...),
+		Max:   append([]float64(nil), vals...),
+		Sum:   append([]float64(nil), vals...),
+	}
+	i := len(bs)
+	for i > 0 && bs[i-1].At.After(start) {
+		i--
+	}
+	bs = append(bs, bucket{})
+	copy(bs[i+1:], bs[i:])
+	bs[i] = b
+	return bs
+}
+
+func mergeInto(b *bucket, vals []float64) {
+	for i, v := range vals {
+		if i >= len(b.Sum) {
+			b.Min = append(b.Min, v)
+			b.Max = append(b.Max, v)
+			b.Sum = append(b.Sum, v)
+			continue
+		}
+		if v < b.Min[i] {
+			b.Min[i] = v
+		}
+		if v > b.Max[i] {
+			b.Max[i] = v
+		}
+		b.Sum[i] += v
+	}
+	b.Count++
+}
+
+// pickTier returns the coarsest tier whose step still gives the resolution
+// a query over [from, to] asks for, moving to coarser tiers when the finer
+// ones no longer retain data as old as from; keep holds the retention of
+// each tier.
+func pickTier(from, to, now time.Time, keep []time.Duration) int {
+	res := to.Sub(from) / maxPoints
+	t := 0
+	for i := len(tiers) - 1; i > 0; i-- {
+		if tiers[i].Step <= res {
+			t = i
+			break
+		}
+	}
+	for t < len(tiers)-1 && from.Before(now.Add(-keep[t])) {
+		t++
+	}
+	return t
+}
+
+// bucketsBetween returns the buckets of tier t (t >= 1) covering
+// [from, to].
+func bucketsBetween(r *rollup, t int, from, to time.Time) []bucket {
+	if t > len(r.Tiers) {
+		return nil
+	}
+	return between(r.Tiers[t-1], func(b bucket) time.Time { return b.At }, from.Truncate(tiers[t].Step), to)
+}
+
+// pruneBuckets drops buckets of tier t (t >= 1) that started before cutoff.
+func pruneBuckets(r *rollup, t int, cutoff time.Time) {
+	if t > len(r.Tiers) {
+		return
+	}
+	r.Tiers[t-1] = keepSince(r.Tiers[t-1], func(b bucket) time.Time { return b.At }, cutoff)
+}
+
+// clone deep-copies r, whose buckets observe updates in place.
+func (r *rollup) clone() *rollup {
+	c := &rollup{Tiers: make([][]bucket, len(r.Tiers))}
+	for i, bs := range r.Tiers {
+		c.Tiers[i] = make([]bucket, len(bs))
+		for j, b := range bs {
+			b.Min, b.Max, b.Sum = slices.Clone(b.Min), slices.Clone(b.Max), slices.Clone(b.Sum)
+			c.Tiers[i][j] = b
+		}
+	}
+	return c
+}
+
+func emptyRollup(r *rollup) bool {
+	for _, bs := range r.Tiers {
+		if len(bs) > 0 {
+			return false
+		}
+	}
+	return true
+}
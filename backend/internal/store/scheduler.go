@@ -0,0 +1,27 @@
+package store
+
+import "time"
+
+// StartScheduler runs due tasks of s once a minute until stop is closed.
+func StartScheduler(s Store, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now().UTC()
+				for _, t := range s.ListTasks() {
+					if !t.Enabled || t.EveryMinutes <= 0 {
+						continue
+					}
+					if t.LastRun.IsZero() || now.Sub(t.LastRun) >= time.Duration(t.EveryMinutes)*time.Minute {
+						go func(id string) { _ = s.RunTaskNow(id) }(t.ID)
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
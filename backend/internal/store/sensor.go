@@ -0,0 +1,69 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// SensorSeries is the history of one sensor, identified by kind, chip and
+// label.
+type SensorSeries struct {
+	Kind   string              `json:"kind"`
+	Chip   string              `json:"chip"`
+	Label  string              `json:"label"`
+	Points []types.SensorPoint `json:"points"`
+}
+
+// sensorFamily rolls the critical threshold up as the bucket maximum, so a
+// sensor that reports one only at times does not get a diluted threshold.
+var sensorFamily = &family[types.SensorPoint]{
+	at: func(p types.SensorPoint) time.Time { return p.At },
+	labels: func(p types.SensorPoint) types.Labels {
+		return types.Labels{"kind": p.Kind, "chip": p.Chip, "sensor": p.Label}
+	},
+	point: func(at time.Time, l types.Labels) types.SensorPoint {
+		return types.SensorPoint{At: at, Kind: l["kind"], Chip: l["chip"], Label: l["sensor"]}
+	},
+	fields: []Field[types.SensorPoint]{
+		floatField("sensor_value", nil, func(p *types.SensorPoint) *float64 { return &p.Value }),
+		floatField("sensor_critical", nil, func(p *types.SensorPoint) *float64 { return &p.Crit }).rolledUpAsMax(),
+	},
+}
+
+func (m *Memory) SaveSensor(p types.SensorPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putSensor(p)
+	if err := m.persist("sensor", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicSensor, p.At, p)
+	return nil
+}
+
+func (m *Memory) putSensor(p types.SensorPoint) { putPoint(m, sensorFamily, p) }
+
+// SensorBetween returns the series of every sensor with samples in
+// [from, to], sorted by kind, chip and label.
+func (m *Memory) SensorBetween(from, to time.Time) []SensorSeries {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	groups := pointsBetween(m, sensorFamily, from, to)
+	res := make([]SensorSeries, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, SensorSeries{Kind: g.labels["kind"], Chip: g.labels["chip"], Label: g.labels["sensor"], Points: g.points})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Chip != b.Chip {
+			return a.Chip < b.Chip
+		}
+		return a.Label < b.Label
+	})
+	return res
+}
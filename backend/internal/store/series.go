@@ -0,0 +1,545 @@
+package store
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// maxSeries bounds how many labeled series SaveSample accepts, so that a
+// script emitting a fresh label value every run cannot exhaust memory.
+const maxSeries = 10000
+
+// ErrTooManySeries is returned by SaveSample when the sample would start a
+// new series beyond maxSeries.
+var ErrTooManySeries = errors.New("too many series")
+
+func (m *Memory) SaveSample(s types.Sample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seriesMu.RLock()
+	_, ok := m.series[types.SeriesID(s.Name, s.Labels)]
+	full := len(m.series) >= maxSeries
+	m.seriesMu.RUnlock()
+	if !ok && full {
+		return ErrTooManySeries
+	}
+	m.putSample(s)
+	if err := m.persist("sample", s); err != nil {
+		return err
+	}
+	m.hub.publish(TopicSample, s.At, s)
+	return nil
+}
+
+// putSample appends s to its series, creating and indexing the series on
+// first use, and folds it into the rollup. Only the series is locked while
+// s is added. A sample older than the newest of its series is dropped and
+// counted, see OutOfOrderSamples. Callers must hold m.mu.
+func (m *Memory) putSample(s types.Sample) {
+	_, series := m.seriesFor(s.Name, s.Labels)
+	series.mu.Lock()
+	defer series.mu.Unlock()
+	if !series.append(s.At, s.Value, m.retention.policy(series.family).RingCap) {
+		m.outOfOrder++
+		return
+	}
+	if !m.migrating {
+		series.rollup.observe(s.At, s.Value)
+	}
+}
+
+// seriesFor returns the series of name and labels, creating and indexing it
+// on first use. Callers must hold m.mu, so no other writer can create the
+// series between the lookup and the creation.
+func (m *Memory) seriesFor(name string, labels types.Labels) (string, *memSeries) {
+	id := types.SeriesID(name, labels)
+	m.seriesMu.RLock()
+	s, ok := m.series[id]
+	m.seriesMu.RUnlock()
+	if !ok {
+		s = &memSeries{name: name, labels: maps.Clone(labels), family: familyOf(name, labels), rollup: &rollup{}}
+		m.seriesMu.Lock()
+		m.series[id] = s
+		m.index(id, s)
+		m.seriesMu.Unlock()
+	}
+	return id, s
+}
+
+// OutOfOrderSamples is how many samples were dropped for being older than
+// the newest sample of their series since the store was opened.
+func (m *Memory) OutOfOrderSamples() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.outOfOrder
+}
+
+// postingKey is the key of the postings list of one label pair.
+func postingKey(name, value string) string { return name + "\x00" + value }
+
+// index adds the series to the postings list of its name and of every label
+// pair. Callers must hold m.seriesMu.
+func (m *Memory) index(id string, s *memSeries) {
+	add := func(k string) {
+		ids, ok := m.postings[k]
+		if !ok {
+			ids = make(map[string]struct{})
+			m.postings[k] = ids
+		}
+		ids[id] = struct{}{}
+	}
+	add(postingKey(types.NameLabel, s.name))
+	for k, v := range s.labels {
+		add(postingKey(k, v))
+	}
+}
+
+func (m *Memory) unindex(id string, s *memSeries) {
+	drop := func(k string) {
+		delete(m.postings[k], id)
+		if len(m.postings[k]) == 0 {
+			delete(m.postings, k)
+		}
+	}
+	drop(postingKey(types.NameLabel, s.name))
+	for k, v := range s.labels {
+		drop(postingKey(k, v))
+	}
+}
+
+// selectIDs returns the sorted IDs of every series matching all of ms. The
+// smallest postings list of an equality matcher with a value seeds the
+// candidates; other matchers have no list and are checked one by one.
+// Callers must hold m.seriesMu for reading.
+func (m *Memory) selectIDs(ms []types.Matcher) []string {
+	var seed map[string]struct{}
+	seeded := false
+	for _, mt := range ms {
+		if mt.Type != types.MatchEqual || mt.Value == "" {
+			continue
+		}
+		ids := m.postings[postingKey(mt.Name, mt.Value)]
+		if !seeded || len(ids) < len(seed) {
+			seed, seeded = ids, true
+		}
+	}
+
+	var out []string
+	consider := func(id string) {
+		s := m.series[id]
+		for _, mt := range ms {
+			if !mt.Matches(s.name, s.labels) {
+				return
+			}
+		}
+		out = append(out, id)
+	}
+	if seeded {
+		for id := range seed {
+			consider(id)
+		}
+	} else {
+		for id := range m.series {
+			consider(id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// pruneSeries applies prune to every series in turn, holding only that
+// series' lock, so readers of the others go on.
+func (m *Memory) pruneSeries(prune func(*memSeries)) {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	for _, s := range m.series {
+		s.mu.Lock()
+		prune(s)
+		s.mu.Unlock()
+	}
+}
+
+// dropEmptySeries forgets series left without raw samples or rollups by
+// pruning. Callers must hold m.mu, keeping out writers that could be about
+// to fill a series.
+func (m *Memory) dropEmptySeries() {
+	m.seriesMu.Lock()
+	defer m.seriesMu.Unlock()
+	for id, s := range m.series {
+		if s.count > 0 || !emptyRollup(s.rollup) {
+			continue
+		}
+		delete(m.series, id)
+		m.unindex(id, s)
+	}
+}
+
+// Select returns every series matching all of ms with samples in
+// [from, to], sorted by series ID. Rolled-up series ending in _total are
+// the bucket maximum, so they stay cumulative; the others are averaged.
+func (m *Memory) Select(from, to time.Time, ms ...types.Matcher) []types.Series {
+	return m.selectSeries(from, to, false, ms)
+}
+
+// SelectRaw is Select restricted to the raw samples, however long the
+// window; series whose raw samples were pruned are left out. Queries whose
+// functions look at every sample of a short range need it.
+func (m *Memory) SelectRaw(from, to time.Time, ms ...types.Matcher) []types.Series {
+	return m.selectSeries(from, to, true, ms)
+}
+
+func (m *Memory) selectSeries(from, to time.Time, raw bool, ms []types.Matcher) []types.Series {
+	res, _, _ := m.SelectPage(from, to, SelectOptions{Raw: raw}, ms...)
+	return res
+}
+
+// Errors of a selection exceeding its SelectOptions.
+var (
+	ErrSeriesLimit = errors.New("selection matches too many series")
+	ErrSampleLimit = errors.New("selection loads too many samples")
+)
+
+// SelectOptions narrow a selection. The zero value selects like Select.
+type SelectOptions struct {
+	// Raw restricts the selection to raw samples, as SelectRaw does.
+	Raw bool
+	// Offset and Limit pick a page of the series with samples in the
+	// window, in ID order. A zero Limit means every series.
+	Offset, Limit int
+	// MaxSeries and MaxSamples, when positive, bound the work: more
+	// matching series fail the selection before anything is loaded, and
+	// loading stops as soon as it passes MaxSamples samples.
+	MaxSeries, MaxSamples int
+}
+
+// SelectPage is Select narrowed by opts. It also returns how many series
+// have samples in the window, of which only the page is loaded. It fails
+// with ErrSeriesLimit or ErrSampleLimit when opts bound the work.
+func (m *Memory) SelectPage(from, to time.Time, opts SelectOptions, ms ...types.Matcher) ([]types.Series, int, error) {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	ids := m.selectIDs(ms)
+	if opts.MaxSeries > 0 && len(ids) > opts.MaxSeries {
+		return nil, 0, ErrSeriesLimit
+	}
+	budget := math.MaxInt
+	if opts.MaxSamples > 0 {
+		budget = opts.MaxSamples
+	}
+	var res []types.Series
+	total := 0
+	for _, id := range ids {
+		s := m.series[id]
+		if opts.Limit > 0 {
+			if !m.hasSamples(s, from, to, opts.Raw) {
+				continue
+			}
+			total++
+			if total <= opts.Offset || total > opts.Offset+opts.Limit {
+				continue
+			}
+		}
+		var pts []types.SamplePoint
+		if opts.Raw {
+			var ok bool
+			s.mu.RLock()
+			pts, ok = s.betweenAtMost(from, to, budget)
+			s.mu.RUnlock()
+			if !ok {
+				return nil, 0, ErrSampleLimit
+			}
+		} else {
+			pts = m.samplesBetween(id, from, to, strings.HasSuffix(s.name, "_total"))
+			if len(pts) > budget {
+				return nil, 0, ErrSampleLimit
+			}
+		}
+		if len(pts) == 0 {
+			continue
+		}
+		budget -= len(pts)
+		if opts.Limit == 0 {
+			total++
+		}
+		res = append(res, types.Series{Name: s.name, Labels: s.labels, Points: pts})
+	}
+	return res, total, nil
+}
+
+// hasSamples reports whether a selection over [from, to] would return
+// samples of s, without decoding them. Callers must hold m.seriesMu for
+// reading.
+func (m *Memory) hasSamples(s *memSeries, from, to time.Time, raw bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !raw {
+		if t := pickTier(from, to, time.Now(), m.retention.policy(s.family).Keep); t > 0 {
+			return len(bucketsBetween(s.rollup, t, from, to)) > 0
+		}
+	}
+	return s.iter(from, to).next()
+}
+
+// LabelValues lists the values label takes across the series of name that
+// hold raw samples, sorted.
+func (m *Memory) LabelValues(name, label string) []string {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	seen := map[string]bool{}
+	for id := range m.postings[postingKey(types.NameLabel, name)] {
+		s := m.series[id]
+		s.mu.RLock()
+		if v, ok := s.labels[label]; ok && s.count > 0 {
+			seen[v] = true
+		}
+		s.mu.RUnlock()
+	}
+	out := make([]string, 0, len(seen))
+	for v := range seen {
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// samplesBetween answers a query over one series from its raw samples or
+// from the rollup tier picked for the window; useMax picks the bucket
+// maximum over the average. Callers must hold m.seriesMu for reading.
+func (m *Memory) samplesBetween(id string, from, to time.Time, useMax bool) []types.SamplePoint {
+	s, ok := m.series[id]
+	if !ok {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t := pickTier(from, to, time.Now(), m.retention.policy(s.family).Keep)
+	if t == 0 {
+		return s.between(from, to)
+	}
+	var out []types.SamplePoint
+	for _, b := range bucketsBetween(s.rollup, t, from, to) {
+		if useMax {
+			out = append(out, types.SamplePoint{At: b.At, V: b.Max[0]})
+		} else {
+			out = append(out, types.SamplePoint{At: b.At, V: b.avg(0)})
+		}
+	}
+	return out
+}
+
+// family describes how a point type is stored as generic series: one series
+// per field, labeled with what identifies the point, e.g. its mount.
+type family[P any] struct {
+	at     func(P) time.Time
+	labels func(P) types.Labels
+	// point returns the empty point at at identified by labels.
+	point  func(at time.Time, l types.Labels) P
+	fields []Field[P]
+}
+
+// Field is one value of a point. Extra labels tell apart fields sharing a
+// metric name, such as the states of cpu_time_percent. Max fields are
+// rolled up as the bucket maximum, for limits and cumulative totals.
+type Field[P any] struct {
+	name  string
+	extra types.Labels
+	max   bool
+	get   func(P) float64
+	set   func(*P, float64)
+}
+
+// floatField is the field stored in the float64 f points to.
+func floatField[P any](name string, extra types.Labels, f func(*P) *float64) Field[P] {
+	return Field[P]{
+		name:  name,
+		extra: extra,
+		get:   func(p P) float64 { return *f(&p) },
+		set:   func(p *P, v float64) { *f(p) = v },
+	}
+}
+
+// uintField is the field stored in the uint64 f points to. Rolled-up values
+// are rounded.
+func uintField[P any](name string, extra types.Labels, f func(*P) *uint64) Field[P] {
+	return Field[P]{
+		name:  name,
+		extra: extra,
+		get:   func(p P) float64 { return float64(*f(&p)) },
+		set:   func(p *P, v float64) { *f(p) = uint64(math.Round(v)) },
+	}
+}
+
+// rolledUpAsMax returns f rolled up as the bucket maximum.
+func (f Field[P]) rolledUpAsMax() Field[P] {
+	f.max = true
+	return f
+}
+
+// Name returns the metric name of f.
+func (f Field[P]) Name() string { return f.name }
+
+// Get returns the value of f in p.
+func (f Field[P]) Get(p P) float64 { return f.get(p) }
+
+// Set stores v in p the way rolled-up values are stored, rounding integers.
+func (f Field[P]) Set(p *P, v float64) { f.set(p, v) }
+
+// Fields returns the fields the store keeps of the point type P, in the
+// order they are stored, or nil if P is not stored as a family. Callers
+// that aggregate points themselves use them to match the rollups.
+func Fields[P any]() []Field[P] {
+	var f any
+	switch any(*new(P)).(type) {
+	case types.CPUPoint:
+		f = cpuFamily
+	case types.CPUTimesPoint:
+		f = cpuTimesFamily
+	case types.LoadPoint:
+		f = loadFamily
+	case types.MemPoint:
+		f = memFamily
+	case types.MemDetailPoint:
+		f = memDetailFamily
+	case types.DiskPoint:
+		f = diskFamily
+	case types.DiskIOPoint:
+		f = diskIOFamily
+	case types.DiskDevicePoint:
+		f = diskDeviceFamily
+	case types.NetPoint:
+		f = netFamily
+	case types.NetIfacePoint:
+		f = netIfaceFamily
+	case types.PressurePoint:
+		f = pressureFamily
+	case types.SensorPoint:
+		f = sensorFamily
+	case types.SocketPoint:
+		f = socketFamily
+	case types.CgroupPoint:
+		f = cgroupFamily
+	default:
+		return nil
+	}
+	return slices.Clone(f.(*family[P]).fields)
+}
+
+func (f Field[P]) labels(l types.Labels) types.Labels {
+	out := make(types.Labels, len(l)+len(f.extra))
+	maps.Copy(out, l)
+	maps.Copy(out, f.extra)
+	return out
+}
+
+// ids returns the series ID of every field of the point identified by l, in
+// field order.
+func (f *family[P]) ids(l types.Labels) []string {
+	out := make([]string, len(f.fields))
+	for i, fl := range f.fields {
+		out[i] = types.SeriesID(fl.name, fl.labels(l))
+	}
+	return out
+}
+
+// names returns the metric names of the fields of f.
+func (f *family[P]) names() []string {
+	out := make([]string, len(f.fields))
+	for i, fl := range f.fields {
+		out[i] = fl.name
+	}
+	return out
+}
+
+// series returns the empty series of every field of the point identified by
+// l, in field order.
+func (f *family[P]) series(l types.Labels) []types.Series {
+	out := make([]types.Series, len(f.fields))
+	for i, fl := range f.fields {
+		out[i] = types.Series{Name: fl.name, Labels: fl.labels(l)}
+	}
+	return out
+}
+
+// putPoint stores every field of p as a sample. Callers must hold m.mu.
+func putPoint[P any](m *Memory, f *family[P], p P) {
+	l, at := f.labels(p), f.at(p)
+	for _, fl := range f.fields {
+		m.putSample(types.Sample{At: at, Name: fl.name, Labels: fl.labels(l), Value: fl.get(p)})
+	}
+}
+
+// pointGroup is the history of one point identity.
+type pointGroup[P any] struct {
+	labels types.Labels
+	points []P
+}
+
+// builtin matches the series of the builtin collectors: exec collectors
+// always set a job label, so a script reporting e.g. disk_used_percent does
+// not show up on the disk page.
+var builtin = types.Matcher{Name: "job"}
+
+// pointsBetween rebuilds the points of every identity matching ms in
+// [from, to] by joining the series of its fields on their timestamps. Groups
+// come sorted by the ID of their first field. Callers must hold m.seriesMu
+// for reading.
+func pointsBetween[P any](m *Memory, f *family[P], from, to time.Time, ms ...types.Matcher) []pointGroup[P] {
+	first := f.fields[0]
+	sel := append([]types.Matcher{{Name: types.NameLabel, Value: first.name}, builtin}, ms...)
+	for k, v := range first.extra {
+		sel = append(sel, types.Matcher{Name: k, Value: v})
+	}
+
+	var out []pointGroup[P]
+	for _, id := range m.selectIDs(sel) {
+		l := maps.Clone(m.series[id].labels)
+		for k := range first.extra {
+			delete(l, k)
+		}
+		var pts []P
+		idx := map[int64]int{}
+		for i, fid := range f.ids(l) {
+			fl := f.fields[i]
+			for _, sp := range m.samplesBetween(fid, from, to, fl.max) {
+				j, ok := idx[sp.At.UnixNano()]
+				if !ok {
+					j = len(pts)
+					idx[sp.At.UnixNano()] = j
+					pts = append(pts, f.point(sp.At, l))
+				}
+				fl.set(&pts[j], sp.V)
+			}
+		}
+		if len(pts) == 0 {
+			continue
+		}
+		sortByTime(pts, f.at)
+		out = append(out, pointGroup[P]{labels: l, points: pts})
+	}
+	return out
+}
+
+// sortByTime orders points joined from several series, which are already
+// in order unless the series disagree about which times they hold.
+func sortByTime[P any](pts []P, at func(P) time.Time) {
+	less := func(i, j int) bool { return at(pts[i]).Before(at(pts[j])) }
+	if !sort.SliceIsSorted(pts, less) {
+		sort.SliceStable(pts, less)
+	}
+}
+
+// onlyPoints returns the points of an unlabeled family.
+func onlyPoints[P any](m *Memory, f *family[P], from, to time.Time) []P {
+	groups := pointsBetween(m, f, from, to)
+	if len(groups) == 0 {
+		return nil
+	}
+	return groups[0].points
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+type SocketSeries struct {
+	Protocol string              `json:"protocol"`
+	State    string              `json:"state"`
+	Points   []types.SocketPoint `json:"points"`
+}
+
+var socketFamily = &family[types.SocketPoint]{
+	at: func(p types.SocketPoint) time.Time { return p.At },
+	labels: func(p types.SocketPoint) types.Labels {
+		return types.Labels{"protocol": p.Protocol, "state": p.State}
+	},
+	point: func(at time.Time, l types.Labels) types.SocketPoint {
+		return types.SocketPoint{At: at, Protocol: l["protocol"], State: l["state"]}
+	},
+	fields: []Field[types.SocketPoint]{{
+		name: "sockets",
+		get:  func(p types.SocketPoint) float64 { return float64(p.Count) },
+		set:  func(p *types.SocketPoint, v float64) { p.Count = int(math.Round(v)) },
+	}},
+}
+
+func (m *Memory) SaveSocket(p types.SocketPoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putSocket(p)
+	if err := m.persist("socket", p); err != nil {
+		return err
+	}
+	m.hub.publish(TopicSocket, p.At, p)
+	return nil
+}
+
+func (m *Memory) putSocket(p types.SocketPoint) { putPoint(m, socketFamily, p) }
+
+// SocketBetween returns the series of every protocol and state with samples
+// in [from, to], sorted by protocol and state.
+func (m *Memory) SocketBetween(from, to time.Time) []SocketSeries {
+	m.seriesMu.RLock()
+	defer m.seriesMu.RUnlock()
+	groups := pointsBetween(m, socketFamily, from, to)
+	res := make([]SocketSeries, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, SocketSeries{Protocol: g.labels["protocol"], State: g.labels["state"], Points: g.points})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Protocol != res[j].Protocol {
+			return res[i].Protocol < res[j].Protocol
+		}
+		return res[i].State < res[j].State
+	})
+	return res
+}
+
+// SavePorts replaces the listening-port inventory and logs every port that
+// opened or closed since the previous inventory. The very first inventory
+// is taken as the baseline and logs nothing.
+func (m *Memory) SavePorts(s types.PortSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := m.ports
+	m.ports = s
+	if err := m.persist("ports", s); err != nil {
+		return err
+	}
+	if !prev.At.IsZero() {
+		old := make(map[string]types.ListeningPort, len(prev.Ports))
+		for _, p := range prev.Ports {
+			old[portKey(p)] = p
+		}
+		for _, p := range s.Ports {
+			if _, ok := old[portKey(p)]; ok {
+				delete(old, portKey(p))
+				continue
+			}
+			m.addLog("INFO", "port opened: "+describePort(p))
+		}
+		for _, p := range prev.Ports {
+			if _, ok := old[portKey(p)]; ok {
+				m.addLog("INFO", "port closed: "+describePort(p))
+			}
+		}
+	}
+	m.hub.publish(TopicPorts, s.At, s)
+	return nil
+}
+
+// Ports returns a copy of the latest listening-port inventory.
+func (m *Memory) Ports() types.PortSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s := m.ports
+	s.Ports = append([]types.ListeningPort(nil), s.Ports...)
+	return s
+}
+
+func portKey(p types.ListeningPort) string {
+	return fmt.Sprintf("%s/%s/%d", p.Protocol, p.Address, p.Port)
+}
+
+func describePort(p types.ListeningPort) string {
+	s := p.Protocol + " " + net.JoinHostPort(p.Address, strconv.Itoa(int(p.Port)))
+	if p.Process != "" {
+		s += fmt.Sprintf(" (%s, pid %d)", p.Process, p.PID)
+	}
+	return s
+}
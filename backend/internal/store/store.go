@@ -0,0 +1,91 @@
+package store
+
+import (
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// Store is everything the HTTP layer, the collector and the task scheduler
+// need from a storage backend. Memory is the reference implementation; any
+// other backend should pass the suite in package storetest.
+type Store interface {
+	List() []*types.Item
+	Get(id string) (*types.Item, error)
+	Create(title, notes string) *types.Item
+	Update(id, title, notes string) (*types.Item, error)
+	Delete(id string) error
+
+	SaveCPU(types.CPUPoint) error
+	SaveCPUCores(types.CPUCoresPoint) error
+	SaveCPUTimes(types.CPUTimesPoint) error
+	SaveLoad(types.LoadPoint) error
+	SaveMem(types.MemPoint) error
+	SaveMemDetail(types.MemDetailPoint) error
+	SaveDisk(types.DiskPoint) error
+	SaveDiskIO(types.DiskIOPoint) error
+	SaveDiskDevice(types.DiskDevicePoint) error
+	SaveNet(types.NetPoint) error
+	SaveNetIface(types.NetIfacePoint) error
+	SavePressure(types.PressurePoint) error
+	SaveCgroup(types.CgroupPoint) error
+	SaveSensor(types.SensorPoint) error
+	SaveSocket(types.SocketPoint) error
+	SavePorts(types.PortSnapshot) error
+	SaveSample(types.Sample) error
+	SaveProcesses(types.ProcessSnapshot) error
+	SetLastCollector(time.Time)
+	LastCollector() time.Time
+
+	CPUSince(since time.Time) []types.CPUPoint
+	MemSince(since time.Time) []types.MemPoint
+	DiskSince(since time.Time) []DiskSeries
+	DiskIOSince(since time.Time) []types.DiskIOPoint
+	NetSince(since time.Time) []types.NetPoint
+	CPUBetween(from, to time.Time) []types.CPUPoint
+	CPUCoresBetween(from, to time.Time) []types.CPUCoresPoint
+	CPUTimesBetween(from, to time.Time) []types.CPUTimesPoint
+	LoadBetween(from, to time.Time) []types.LoadPoint
+	MemBetween(from, to time.Time) []types.MemPoint
+	MemDetailBetween(from, to time.Time) []types.MemDetailPoint
+	DiskBetween(from, to time.Time) []DiskSeries
+	DiskIOBetween(from, to time.Time) []types.DiskIOPoint
+	DiskDeviceBetween(from, to time.Time) []DiskDeviceSeries
+	DiskDevices() []string
+	NetBetween(from, to time.Time) []types.NetPoint
+	NetIfaceBetween(from, to time.Time) []NetIfaceSeries
+	PressureBetween(from, to time.Time) []PressureSeries
+	PressureResources() []string
+	CgroupBetween(from, to time.Time) []CgroupSeries
+	SensorBetween(from, to time.Time) []SensorSeries
+	SocketBetween(from, to time.Time) []SocketSeries
+	Ports() types.PortSnapshot
+	ProcessesAt(at time.Time) (types.ProcessSnapshot, bool)
+
+	// Select and LabelValues query the generic series every metric is
+	// stored as; the typed *Between methods above are views over them.
+	Select(from, to time.Time, ms ...types.Matcher) []types.Series
+	SelectRaw(from, to time.Time, ms ...types.Matcher) []types.Series
+	SelectPage(from, to time.Time, opts SelectOptions, ms ...types.Matcher) ([]types.Series, int, error)
+	LabelValues(name, label string) []string
+	// OutOfOrderSamples counts the samples dropped for being older than
+	// the newest sample of their series; series only grow forwards.
+	OutOfOrderSamples() uint64
+
+	PruneOlderThan(cutoff time.Time) error
+	RetentionStatus() []RetentionStatus
+	SetRetention(Retention) error
+
+	AddLog(level, msg string)
+	ListLogs(limit int, filter string) []LogEntry
+	LogsBetween(from, to time.Time, limit int, filter string) []LogEntry
+
+	ListTasks() []*Task
+	CreateTask(name string, every int) *Task
+	DeleteTask(id string) error
+	RunTaskNow(id string) error
+
+	Subscribe(topics ...string) *Subscription
+}
+
+var _ Store = (*Memory)(nil)
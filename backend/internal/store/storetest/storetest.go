@@ -0,0 +1,285 @@
+// Package storetest is a conformance suite for store.Store implementations.
+//
+// A backend hooks in from its own test file:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.Store { return store.NewMemory() })
+//	}
+package storetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kebab0o/sysdash/backend/internal/store"
+	"github.com/kebab0o/sysdash/backend/internal/types"
+)
+
+// Run exercises s against the behaviour the HTTP layer and the collector
+// rely on. newStore must return an empty store for every call.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	t.Run("Items", func(t *testing.T) { testItems(t, newStore(t)) })
+	t.Run("Metrics", func(t *testing.T) { testMetrics(t, newStore(t)) })
+	t.Run("Disk", func(t *testing.T) { testDisk(t, newStore(t)) })
+	t.Run("Series", func(t *testing.T) { testSeries(t, newStore(t)) })
+	t.Run("Prune", func(t *testing.T) { testPrune(t, newStore(t)) })
+	t.Run("Collector", func(t *testing.T) { testCollector(t, newStore(t)) })
+	t.Run("Tasks", func(t *testing.T) { testTasks(t, newStore(t)) })
+	t.Run("Logs", func(t *testing.T) { testLogs(t, newStore(t)) })
+	t.Run("Subscribe", func(t *testing.T) { testSubscribe(t, newStore(t)) })
+}
+
+func testItems(t *testing.T, s store.Store) {
+	a := s.Create("a", "first")
+	time.Sleep(time.Millisecond)
+	b := s.Create("b", "second")
+
+	got, err := s.Get(a.ID)
+	if err != nil || got.Title != "a" || got.Notes != "first" {
+		t.Fatalf("Get(a) = %+v, %v", got, err)
+	}
+	if l := s.List(); len(l) != 2 || l[0].ID != b.ID {
+		t.Fatalf("List() should return newest first, got %+v", l)
+	}
+
+	up, err := s.Update(a.ID, "", "changed")
+	if err != nil || up.Title != "a" || up.Notes != "changed" {
+		t.Fatalf("Update with empty title = %+v, %v", up, err)
+	}
+	if _, err := s.Update("missing", "x", "y"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Update(missing) err = %v, want ErrNotFound", err)
+	}
+
+	if err := s.Delete(a.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(a.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Get after Delete err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(a.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second Delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func testMetrics(t *testing.T, s store.Store) {
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 10; i++ {
+		at := base.Add(time.Duration(i) * time.Minute)
+		mustSave(t, s.SaveCPU(types.CPUPoint{At: at, V: float64(i)}))
+		mustSave(t, s.SaveMem(types.MemPoint{At: at, V: float64(i)}))
+		mustSave(t, s.SaveDiskIO(types.DiskIOPoint{At: at, ReadMBs: float64(i)}))
+		mustSave(t, s.SaveNet(types.NetPoint{At: at, RxKBs: float64(i)}))
+	}
+
+	since := base.Add(5 * time.Minute)
+	if pts := s.CPUSince(since); len(pts) != 5 || pts[0].V != 5 || pts[4].V != 9 {
+		t.Fatalf("CPUSince = %+v, want values 5..9", pts)
+	}
+	if pts := s.MemSince(since); len(pts) != 5 || pts[0].V != 5 {
+		t.Fatalf("MemSince = %+v, want values 5..9", pts)
+	}
+	if pts := s.DiskIOSince(since); len(pts) != 5 || pts[0].ReadMBs != 5 {
+		t.Fatalf("DiskIOSince = %+v, want values 5..9", pts)
+	}
+	if pts := s.NetSince(since); len(pts) != 5 || pts[0].RxKBs != 5 {
+		t.Fatalf("NetSince = %+v, want values 5..9", pts)
+	}
+	if pts := s.CPUSince(time.Now().Add(time.Hour)); len(pts) != 0 {
+		t.Fatalf("CPUSince(future) = %+v, want none", pts)
+	}
+}
+
+func testDisk(t *testing.T, s store.Store) {
+	at := time.Now().UTC().Add(-time.Minute)
+	mustSave(t, s.SaveDisk(types.DiskPoint{At: at, Mount: "/var", UsedPct: 50}))
+	mustSave(t, s.SaveDisk(types.DiskPoint{At: at, Mount: "/", UsedPct: 10}))
+
+	series := s.DiskSince(at.Add(-time.Second))
+	if len(series) != 2 || series[0].Mount != "/" || series[1].Mount != "/var" {
+		t.Fatalf("DiskSince = %+v, want / and /var sorted by mount", series)
+	}
+	if len(series[1].Points) != 1 || series[1].Points[0].UsedPct != 50 {
+		t.Fatalf("DiskSince /var points = %+v", series[1].Points)
+	}
+	if got := s.DiskSince(at.Add(time.Second)); len(got) != 0 {
+		t.Fatalf("DiskSince after last point = %+v, want no mounts", got)
+	}
+}
+
+func testSeries(t *testing.T, s store.Store) {
+	at := time.Now().UTC().Add(-time.Minute)
+	mustSave(t, s.SaveDisk(types.DiskPoint{At: at, Mount: "/", UsedPct: 10}))
+	mustSave(t, s.SaveSample(types.Sample{At: at, Name: "queue_depth", Labels: types.Labels{"job": "q", "queue": "mail"}, Value: 3}))
+	mustSave(t, s.SaveSample(types.Sample{At: at, Name: "queue_depth", Labels: types.Labels{"job": "q", "queue": "sms"}, Value: 4}))
+	from, to := at.Add(-time.Second), at.Add(time.Second)
+
+	got := s.Select(from, to, types.Matcher{Name: types.NameLabel, Value: "disk_used_percent"})
+	if len(got) != 1 || got[0].Labels["mount"] != "/" || len(got[0].Points) != 1 || got[0].Points[0].V != 10 {
+		t.Fatalf("Select(disk_used_percent) = %+v, want the / series at 10", got)
+	}
+	got = s.Select(from, to, types.Matcher{Name: types.NameLabel, Value: "queue_depth"}, types.Matcher{Name: "queue", Value: "sms"})
+	if len(got) != 1 || got[0].Points[0].V != 4 {
+		t.Fatalf("Select(queue_depth, queue=sms) = %+v, want the sms series", got)
+	}
+	if got = s.Select(from, to, types.Matcher{Name: "queue", Value: ""}, types.Matcher{Name: "job", Value: "q"}); len(got) != 0 {
+		t.Fatalf("Select(job=q, no queue label) = %+v, want none", got)
+	}
+	if v := s.LabelValues("queue_depth", "queue"); len(v) != 2 || v[0] != "mail" || v[1] != "sms" {
+		t.Fatalf("LabelValues(queue_depth, queue) = %v, want [mail sms]", v)
+	}
+
+	// A page counts only the series with samples in the window; an empty
+	// one is left out of both.
+	mustSave(t, s.SaveSample(types.Sample{At: at.Add(-time.Hour), Name: "queue_depth", Labels: types.Labels{"job": "q", "queue": "old"}, Value: 1}))
+	page, total, err := s.SelectPage(from, to, store.SelectOptions{Offset: 1, Limit: 1}, types.Matcher{Name: "job", Value: "q"})
+	if err != nil || total != 2 || len(page) != 1 || page[0].Labels["queue"] != "sms" {
+		t.Fatalf("SelectPage(job=q, offset 1, limit 1) = %+v, %d; want the sms series of 2", page, total)
+	}
+	if page, total, _ = s.SelectPage(from, to, store.SelectOptions{Offset: 2, Limit: 1}, types.Matcher{Name: "job", Value: "q"}); total != 2 || len(page) != 0 {
+		t.Fatalf("SelectPage past the end = %+v, %d; want none of 2", page, total)
+	}
+	// The series limit counts every match, with samples in the window or
+	// not; the sample limit counts what was loaded.
+	jobQ := types.Matcher{Name: "job", Value: "q"}
+	if _, _, err = s.SelectPage(from, to, store.SelectOptions{MaxSeries: 2}, jobQ); !errors.Is(err, store.ErrSeriesLimit) {
+		t.Fatalf("SelectPage(job=q, 2 series at most) err = %v, want ErrSeriesLimit", err)
+	}
+	if _, _, err = s.SelectPage(from, to, store.SelectOptions{Raw: true, MaxSamples: 1}, jobQ); !errors.Is(err, store.ErrSampleLimit) {
+		t.Fatalf("SelectPage(job=q, 1 sample at most) err = %v, want ErrSampleLimit", err)
+	}
+	if page, _, err = s.SelectPage(from, to, store.SelectOptions{Raw: true, MaxSeries: 3, MaxSamples: 2}, jobQ); err != nil || len(page) != 2 {
+		t.Fatalf("SelectPage(job=q, within limits) = %+v, %v; want 2 series", page, err)
+	}
+	notMail, _ := types.NewMatcher(types.MatchNotEqual, "queue", "mail")
+	if got = s.Select(from, to, jobQ, notMail); len(got) != 1 || got[0].Labels["queue"] != "sms" {
+		t.Fatalf("Select(job=q, queue!=mail) = %+v, want the sms series", got)
+	}
+
+	// A sample older than the newest of its series is dropped and counted;
+	// one at the same time is kept.
+	mustSave(t, s.SaveSample(types.Sample{At: at.Add(-time.Millisecond), Name: "queue_depth", Labels: types.Labels{"job": "q", "queue": "sms"}, Value: 5}))
+	mustSave(t, s.SaveSample(types.Sample{At: at, Name: "queue_depth", Labels: types.Labels{"job": "q", "queue": "sms"}, Value: 6}))
+	if n := s.OutOfOrderSamples(); n != 1 {
+		t.Fatalf("OutOfOrderSamples() = %d, want 1", n)
+	}
+	got = s.Select(from.Add(-time.Second), to, types.Matcher{Name: "queue", Value: "sms"})
+	if len(got) != 1 || len(got[0].Points) != 2 || got[0].Points[1].V != 6 {
+		t.Fatalf("Select(queue=sms) = %+v, want the samples 4 and 6", got)
+	}
+}
+
+func testPrune(t *testing.T, s store.Store) {
+	now := time.Now().UTC()
+	old, recent := now.Add(-2*time.Hour), now.Add(-time.Minute)
+	for _, at := range []time.Time{old, recent} {
+		mustSave(t, s.SaveCPU(types.CPUPoint{At: at, V: 1}))
+		mustSave(t, s.SaveDisk(types.DiskPoint{At: at, Mount: "/"}))
+	}
+	if err := s.PruneOlderThan(now.Add(-time.Hour)); err != nil {
+		t.Fatalf("PruneOlderThan: %v", err)
+	}
+	if pts := s.CPUSince(old.Add(-time.Minute)); len(pts) != 1 || !pts[0].At.Equal(recent) {
+		t.Fatalf("CPU after prune = %+v, want only the recent point", pts)
+	}
+	if series := s.DiskSince(old.Add(-time.Minute)); len(series) != 1 || len(series[0].Points) != 1 {
+		t.Fatalf("disk after prune = %+v, want one point", series)
+	}
+}
+
+func testCollector(t *testing.T, s store.Store) {
+	if !s.LastCollector().IsZero() {
+		t.Fatalf("LastCollector on empty store = %v, want zero", s.LastCollector())
+	}
+	at := time.Now().UTC().Truncate(time.Second)
+	s.SetLastCollector(at)
+	if got := s.LastCollector(); !got.Equal(at) {
+		t.Fatalf("LastCollector = %v, want %v", got, at)
+	}
+}
+
+func testTasks(t *testing.T, s store.Store) {
+	b := s.CreateTask("b-task", 5)
+	a := s.CreateTask("a-task", 10)
+	if !a.Enabled || a.EveryMinutes != 10 || a.ID == "" {
+		t.Fatalf("CreateTask = %+v", a)
+	}
+
+	tasks := s.ListTasks()
+	if len(tasks) != 2 || tasks[0].ID != a.ID || tasks[1].ID != b.ID {
+		t.Fatalf("ListTasks should sort by name, got %+v", tasks)
+	}
+	tasks[0].Name = "mutated"
+	if s.ListTasks()[0].Name != "a-task" {
+		t.Fatal("ListTasks must not hand out the stored task")
+	}
+
+	if err := s.RunTaskNow("missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("RunTaskNow(missing) err = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteTask(b.ID); err != nil {
+		t.Fatalf("DeleteTask: %v", err)
+	}
+	if err := s.DeleteTask(b.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second DeleteTask err = %v, want ErrNotFound", err)
+	}
+	if tasks := s.ListTasks(); len(tasks) != 1 {
+		t.Fatalf("ListTasks after delete = %+v", tasks)
+	}
+}
+
+func testLogs(t *testing.T, s store.Store) {
+	s.CreateTask("Alpha", 1)
+	s.CreateTask("beta", 1)
+
+	logs := s.ListLogs(10, "")
+	if len(logs) != 2 || logs[0].Msg != "task created: beta" {
+		t.Fatalf("ListLogs should return newest first, got %+v", logs)
+	}
+	if logs := s.ListLogs(10, "ALPHA"); len(logs) != 1 {
+		t.Fatalf("ListLogs filter should be case-insensitive, got %+v", logs)
+	}
+	if logs := s.ListLogs(1, ""); len(logs) != 1 {
+		t.Fatalf("ListLogs limit ignored, got %+v", logs)
+	}
+}
+
+func testSubscribe(t *testing.T, s store.Store) {
+	cpu := s.Subscribe(store.TopicCPU)
+	all := s.Subscribe()
+	defer all.Close()
+
+	mustSave(t, s.SaveMem(types.MemPoint{At: time.Now().UTC(), V: 1}))
+	mustSave(t, s.SaveCPU(types.CPUPoint{At: time.Now().UTC(), V: 2}))
+
+	select {
+	case e := <-cpu.C:
+		if e.Topic != store.TopicCPU {
+			t.Fatalf("cpu subscriber got %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cpu subscriber got no event")
+	}
+	for _, want := range []string{store.TopicMem, store.TopicCPU} {
+		select {
+		case e := <-all.C:
+			if e.Topic != want {
+				t.Fatalf("got topic %q, want %q", e.Topic, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event for unfiltered subscriber", want)
+		}
+	}
+
+	cpu.Close()
+	if _, ok := <-cpu.C; ok {
+		t.Fatal("closed subscription still delivers")
+	}
+}
+
+func mustSave(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+}
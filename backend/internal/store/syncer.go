@@ -0,0 +1,25 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+// StartSyncer flushes the write-ahead log of m to disk every interval until
+// stop is closed, bounding what a crash can lose to about one interval.
+func StartSyncer(m *Memory, every time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Sync(); err != nil {
+					log.Printf("store: sync write-ahead log: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
@@ -1,23 +1,73 @@
 package types
 
-import "time"
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type CPUPoint struct {
 	At time.Time `json:"t"`
 	V  float64   `json:"v"`
 }
 
+// CPUCoresPoint holds the utilisation percentage of every logical core.
+type CPUCoresPoint struct {
+	At    time.Time `json:"t"`
+	Cores []float64 `json:"cores"`
+}
+
+// CPUTimesPoint splits CPU time spent since the previous sample by state,
+// each as a percentage of the total.
+type CPUTimesPoint struct {
+	At      time.Time `json:"t"`
+	User    float64   `json:"user"`
+	Nice    float64   `json:"nice"`
+	System  float64   `json:"system"`
+	Idle    float64   `json:"idle"`
+	Iowait  float64   `json:"iowait"`
+	Irq     float64   `json:"irq"`
+	Softirq float64   `json:"softirq"`
+	Steal   float64   `json:"steal"`
+}
+
+type LoadPoint struct {
+	At     time.Time `json:"t"`
+	Load1  float64   `json:"load1"`
+	Load5  float64   `json:"load5"`
+	Load15 float64   `json:"load15"`
+}
+
 type MemPoint struct {
 	At time.Time `json:"t"`
 	V  float64   `json:"v"`
 }
 
+// MemDetailPoint is the full memory breakdown. Sizes are in bytes.
+type MemDetailPoint struct {
+	At                time.Time `json:"t"`
+	Total             uint64    `json:"total"`
+	Available         uint64    `json:"available"`
+	Used              uint64    `json:"used"`
+	Cached            uint64    `json:"cached"`
+	Buffers           uint64    `json:"buffers"`
+	SwapUsed          uint64    `json:"swapUsed"`
+	SwapTotal         uint64    `json:"swapTotal"`
+	MajorFaultsPerSec float64   `json:"majorFaultsPerSec"`
+}
+
 type DiskPoint struct {
 	At      time.Time `json:"t"`
 	Mount   string    `json:"mount"`
 	UsedPct float64   `json:"usedPct"`
 	UsedGB  float64   `json:"usedGB"`
 	TotalGB float64   `json:"totalGB"`
+
+	InodesUsed    uint64  `json:"inodesUsed"`
+	InodesFree    uint64  `json:"inodesFree"`
+	InodesUsedPct float64 `json:"inodesUsedPct"`
 }
 
 type DiskIOPoint struct {
@@ -26,12 +76,234 @@ type DiskIOPoint struct {
 	WriteMBs float64   `json:"writeMBs"`
 }
 
+// DiskDevicePoint holds the activity of one whole block device since the
+// previous sample.
+type DiskDevicePoint struct {
+	At         time.Time `json:"t"`
+	Device     string    `json:"device"`
+	ReadBytes  float64   `json:"readBytes"`
+	WriteBytes float64   `json:"writeBytes"`
+	ReadIOPS   float64   `json:"readIops"`
+	WriteIOPS  float64   `json:"writeIops"`
+	AwaitMs    float64   `json:"awaitMs"`
+	UtilPct    float64   `json:"utilPct"`
+}
+
 type NetPoint struct {
 	At    time.Time `json:"t"`
 	RxKBs float64   `json:"rxKBs"`
 	TxKBs float64   `json:"txKBs"`
 }
 
+// NetIfacePoint holds the per-second rates of one network interface.
+type NetIfacePoint struct {
+	At        time.Time `json:"t"`
+	Iface     string    `json:"iface"`
+	RxBytes   float64   `json:"rxBytes"`
+	TxBytes   float64   `json:"txBytes"`
+	RxPackets float64   `json:"rxPackets"`
+	TxPackets float64   `json:"txPackets"`
+	RxErrors  float64   `json:"rxErrors"`
+	TxErrors  float64   `json:"txErrors"`
+	RxDrops   float64   `json:"rxDrops"`
+	TxDrops   float64   `json:"txDrops"`
+}
+
+// PressurePoint holds the pressure-stall information of one resource (cpu,
+// memory or io). The averages are the percentage of time at least one task
+// (Some) or every non-idle task (Full) was stalled; the totals are cumulative
+// stall time in microseconds.
+type PressurePoint struct {
+	At         time.Time `json:"t"`
+	Resource   string    `json:"resource"`
+	SomeAvg10  float64   `json:"someAvg10"`
+	SomeAvg60  float64   `json:"someAvg60"`
+	SomeAvg300 float64   `json:"someAvg300"`
+	SomeTotal  uint64    `json:"someTotal"`
+	FullAvg10  float64   `json:"fullAvg10"`
+	FullAvg60  float64   `json:"fullAvg60"`
+	FullAvg300 float64   `json:"fullAvg300"`
+	FullTotal  uint64    `json:"fullTotal"`
+}
+
+// SensorPoint is one reading of a hardware sensor. Kind is "temp" (degrees
+// Celsius) or "fan" (RPM); Chip and Label identify the sensor. Crit is the
+// critical threshold in the same unit, 0 when the sensor has none.
+type SensorPoint struct {
+	At    time.Time `json:"t"`
+	Kind  string    `json:"kind"`
+	Chip  string    `json:"chip"`
+	Label string    `json:"label"`
+	Value float64   `json:"value"`
+	Crit  float64   `json:"crit,omitempty"`
+}
+
+// CgroupPoint holds the resource usage of one cgroup v2 group since the
+// previous sample. Path is relative to the cgroup root, which itself is "/".
+// CPUPct is relative to one core; MemoryMax is 0 when unlimited.
+type CgroupPoint struct {
+	At            time.Time `json:"t"`
+	Path          string    `json:"path"`
+	CPUPct        float64   `json:"cpuPct"`
+	MemoryCurrent uint64    `json:"memoryCurrent"`
+	MemoryMax     uint64    `json:"memoryMax"`
+	IOReadBytes   float64   `json:"ioReadBytes"`
+	IOWriteBytes  float64   `json:"ioWriteBytes"`
+	IOReadIOPS    float64   `json:"ioReadIops"`
+	IOWriteIOPS   float64   `json:"ioWriteIops"`
+	Pids          uint64    `json:"pids"`
+}
+
+// SocketPoint counts the sockets of one protocol ("tcp" or "udp") in one
+// state. UDP sockets have no state and are counted under "ALL".
+type SocketPoint struct {
+	At       time.Time `json:"t"`
+	Protocol string    `json:"protocol"`
+	State    string    `json:"state"`
+	Count    int       `json:"count"`
+}
+
+// ListeningPort is a TCP socket in LISTEN or an unconnected UDP socket. PID
+// and Process are empty when the owner could not be resolved, typically
+// because it belongs to another user.
+type ListeningPort struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+	PID      int32  `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+// PortSnapshot is the listening-port inventory at one point in time.
+type PortSnapshot struct {
+	At    time.Time       `json:"t"`
+	Ports []ListeningPort `json:"ports"`
+}
+
+// Labels tell apart the series of one metric name.
+type Labels map[string]string
+
+// NameLabel is the pseudo label a Matcher uses to select by metric name.
+const NameLabel = "__name__"
+
+// Sample is one value of a generic labeled series. Every collected metric is
+// stored as such series; the point types above are views over them.
+type Sample struct {
+	At     time.Time `json:"t"`
+	Name   string    `json:"name"`
+	Labels Labels    `json:"labels,omitempty"`
+	Value  float64   `json:"v"`
+}
+
+// SamplePoint is one value of a series whose name and labels are known from
+// context.
+type SamplePoint struct {
+	At time.Time `json:"t"`
+	V  float64   `json:"v"`
+}
+
+// Series is the history of one metric name and label set.
+type Series struct {
+	Name   string        `json:"name"`
+	Labels Labels        `json:"labels"`
+	Points []SamplePoint `json:"points"`
+}
+
+// SeriesID renders name and labels the way Prometheus does, with the labels
+// sorted, e.g. queue_depth{job="jobs",queue="mail"}. It identifies a series.
+func SeriesID(name string, labels Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k + "=" + strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// MatchType is how a Matcher compares a label value.
+type MatchType int
+
+const (
+	MatchEqual MatchType = iota
+	MatchRegexp
+	MatchNotEqual
+	MatchNotRegexp
+)
+
+// Matcher selects series by the value of label Name, which may be NameLabel
+// to match the metric name. A missing label has the empty value, so
+// {Name: "job"} selects the series without a job label. Regexp matchers
+// must come from NewMatcher.
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// NewMatcher returns a matcher of the given type. A regexp value is
+// anchored at both ends, as in Prometheus.
+func NewMatcher(t MatchType, name, value string) (Matcher, error) {
+	m := Matcher{Type: t, Name: name, Value: value}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return m, err
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether the series name and labels satisfy m.
+func (m Matcher) Matches(name string, labels Labels) bool {
+	v := labels[m.Name]
+	if m.Name == NameLabel {
+		v = name
+	}
+	switch m.Type {
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return v == m.Value
+}
+
+// ProcessInfo describes one process at the time of a snapshot. ReadBytes and
+// WriteBytes are cumulative since the process started.
+type ProcessInfo struct {
+	PID        int32   `json:"pid"`
+	Name       string  `json:"name"`
+	Cmdline    string  `json:"cmdline"`
+	User       string  `json:"user"`
+	Threads    int32   `json:"threads"`
+	FDs        int32   `json:"fds"`
+	CPUPct     float64 `json:"cpuPct"`
+	RSSBytes   uint64  `json:"rssBytes"`
+	ReadBytes  uint64  `json:"readBytes"`
+	WriteBytes uint64  `json:"writeBytes"`
+}
+
+// ProcessSnapshot holds the heaviest processes by CPU and by RSS.
+type ProcessSnapshot struct {
+	At        time.Time     `json:"t"`
+	Processes []ProcessInfo `json:"processes"`
+}
+
 type Item struct {
 	ID        string    `json:"id"`
 	Title     string    `json:"title"`